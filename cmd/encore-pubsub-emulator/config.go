@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"go.encore.dev/platform-sdk/internal/emulator"
+	"go.encore.dev/platform-sdk/pkg/auth"
+)
+
+// config is the configuration file of the emulator, for instance:
+//
+//	{
+//	  "app_slug": "my-app",
+//	  "env_name": "local",
+//	  "auth_keys": [{"kid": 1, "data": "<base64 encoded key data>"}],
+//	  "topics": {
+//	    "orders": {
+//	      "subscriptions": {
+//	        "ship-order": {
+//	          "push_endpoint": "http://localhost:4000/__encore/pubsub/push/ship-order",
+//	          "ack_deadline": "30s",
+//	          "max_delivery_attempts": 5,
+//	          "min_backoff": "1s",
+//	          "max_backoff": "1m",
+//	          "max_in_flight": 10,
+//	          "max_batch_size": 10
+//	        }
+//	      }
+//	    }
+//	  }
+//	}
+type config struct {
+	AppSlug  string                 `json:"app_slug"`
+	EnvName  string                 `json:"env_name"`
+	AuthKeys []auth.Key             `json:"auth_keys"`
+	Topics   map[string]topicConfig `json:"topics"`
+
+	// AutoCreateTopics creates topics on their first publish, rather than rejecting them
+	AutoCreateTopics bool `json:"auto_create_topics"`
+
+	// DeduplicationWindow is how long deduplication IDs are remembered for (defaults to "10m")
+	DeduplicationWindow duration `json:"deduplication_window"`
+}
+
+type topicConfig struct {
+	Subscriptions map[string]subscriptionConfig `json:"subscriptions"`
+}
+
+type subscriptionConfig struct {
+	PushEndpoint        string   `json:"push_endpoint"`
+	AckDeadline         duration `json:"ack_deadline"`
+	MaxDeliveryAttempts int      `json:"max_delivery_attempts"`
+	MinBackoff          duration `json:"min_backoff"`
+	MaxBackoff          duration `json:"max_backoff"`
+	MaxInFlight         int      `json:"max_in_flight"`
+	MaxBatchSize        int      `json:"max_batch_size"`
+}
+
+// duration is a [time.Duration] encoded in JSON as a string such as "30s".
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("expected a duration string such as \"30s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err // nolint: wrapcheck
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+// loadConfig reads and validates the configuration file at path.
+func loadConfig(path string) (*config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config: %w", err)
+	}
+	return parseConfig(data)
+}
+
+// parseConfig parses and validates a configuration file.
+func parseConfig(data []byte) (*config, error) {
+	cfg := &config{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return cfg, nil
+}
+
+func (cfg *config) validate() error {
+	var errs []error
+	if cfg.AppSlug == "" {
+		errs = append(errs, errors.New("no app_slug configured"))
+	}
+	if cfg.EnvName == "" {
+		errs = append(errs, errors.New("no env_name configured"))
+	}
+	if len(cfg.AuthKeys) == 0 {
+		errs = append(errs, errors.New("no auth_keys configured"))
+	}
+	for i, key := range cfg.AuthKeys {
+		if len(key.Data) == 0 {
+			errs = append(errs, fmt.Errorf("auth key %d has no data", key.KeyID))
+		}
+		for _, other := range cfg.AuthKeys[:i] {
+			if other.KeyID == key.KeyID {
+				errs = append(errs, fmt.Errorf("auth key %d configured multiple times", key.KeyID))
+				break
+			}
+		}
+	}
+	for topicID, topic := range cfg.Topics {
+		for subID, sub := range topic.Subscriptions {
+			if sub.PushEndpoint == "" {
+				errs = append(errs, fmt.Errorf("subscription %q of topic %q has no push_endpoint", subID, topicID))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// emulatorConfig returns the configuration of the emulator.
+func (cfg *config) emulatorConfig() emulator.Config {
+	topics := make(map[string]emulator.TopicConfig, len(cfg.Topics))
+	for topicID, topic := range cfg.Topics {
+		subs := make(map[string]emulator.SubscriptionConfig, len(topic.Subscriptions))
+		for subID, sub := range topic.Subscriptions {
+			subs[subID] = emulator.SubscriptionConfig{
+				PushEndpoint:        sub.PushEndpoint,
+				AckDeadline:         time.Duration(sub.AckDeadline),
+				MaxDeliveryAttempts: sub.MaxDeliveryAttempts,
+				MinBackoff:          time.Duration(sub.MinBackoff),
+				MaxBackoff:          time.Duration(sub.MaxBackoff),
+				MaxInFlight:         sub.MaxInFlight,
+				MaxBatchSize:        sub.MaxBatchSize,
+			}
+		}
+		topics[topicID] = emulator.TopicConfig{Subscriptions: subs}
+	}
+
+	return emulator.Config{
+		AppSlug:          cfg.AppSlug,
+		EnvName:          cfg.EnvName,
+		Keys:             cfg.AuthKeys,
+		Topics:           topics,
+		AutoCreateTopics: cfg.AutoCreateTopics,
+
+		DeduplicationWindow: time.Duration(cfg.DeduplicationWindow),
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"go.encore.dev/platform-sdk/internal/emulator"
+	"go.encore.dev/platform-sdk/pkg/auth"
+)
+
+func TestParseConfig(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		config  string
+		want    emulator.Config
+		wantErr string
+	}{
+		{
+			name: "valid",
+			config: `{
+				"app_slug": "my-app",
+				"env_name": "local",
+				"auth_keys": [{"kid": 1, "data": "a2V5"}],
+				"topics": {
+					"orders": {
+						"subscriptions": {
+							"ship": {"push_endpoint": "http://localhost:4000/ship", "ack_deadline": "10s", "max_delivery_attempts": 3}
+						}
+					},
+					"empty": {}
+				}
+			}`,
+			want: emulator.Config{
+				AppSlug: "my-app",
+				EnvName: "local",
+				Keys:    []auth.Key{{KeyID: 1, Data: []byte("key")}},
+				Topics: map[string]emulator.TopicConfig{
+					"orders": {Subscriptions: map[string]emulator.SubscriptionConfig{
+						"ship": {PushEndpoint: "http://localhost:4000/ship", AckDeadline: 10 * time.Second, MaxDeliveryAttempts: 3},
+					}},
+					"empty": {Subscriptions: map[string]emulator.SubscriptionConfig{}},
+				},
+			},
+		},
+		{
+			name:    "missing fields",
+			config:  `{"topics": {"orders": {"subscriptions": {"ship": {}}}}}`,
+			wantErr: "invalid config: no app_slug configured\nno env_name configured\nno auth_keys configured\nsubscription \"ship\" of topic \"orders\" has no push_endpoint",
+		},
+		{
+			name:    "duplicate keys",
+			config:  `{"app_slug": "my-app", "env_name": "local", "auth_keys": [{"kid": 1, "data": "a2V5"}, {"kid": 1, "data": "a2V5"}]}`,
+			wantErr: "invalid config: auth key 1 configured multiple times",
+		},
+		{
+			name:    "invalid duration",
+			config:  `{"topics": {"orders": {"subscriptions": {"ship": {"ack_deadline": 30}}}}}`,
+			wantErr: `invalid config: expected a duration string such as "30s": .*`,
+		},
+		{
+			name:    "unknown field",
+			config:  `{"app": "my-app"}`,
+			wantErr: `invalid config: json: unknown field "app"`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := qt.New(t)
+
+			cfg, err := parseConfig([]byte(tt.config))
+			if tt.wantErr != "" {
+				c.Assert(err, qt.ErrorMatches, tt.wantErr)
+				return
+			}
+			c.Assert(err, qt.IsNil)
+			c.Assert(cfg.emulatorConfig(), qt.DeepEquals, tt.want)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+// Command encore-pubsub-emulator emulates Encore Cloud PubSub locally, for offline development.
+//
+// It accepts publishes signed by the SDK, and pushes the messages to the subscriptions
+// configured in its config file with signed requests, honouring ordering keys and
+// redelivering messages which are nacked or time out. Point the SDK at it using
+// [platform.WithHost]:
+//
+//	encore-pubsub-emulator -config pubsub.json -addr localhost:8740
+//
+// The queues can be inspected using the admin API:
+//
+//	GET  /admin/topics                            lists the topics
+//	GET  /admin/subscriptions                     lists the subscriptions
+//	GET  /admin/subscriptions/{id}                describes a subscription and its queue
+//	GET  /admin/subscriptions/{id}/deliveries     lists the completed delivery attempts of a subscription
+//	POST /admin/subscriptions/{id}/purge          removes the messages waiting to be pushed to a subscription
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"go.encore.dev/platform-sdk/internal/emulator"
+	"go.encore.dev/platform-sdk/pkg/logging"
+)
+
+func main() {
+	configPath := flag.String("config", "pubsub.json", "the path of the config file")
+	addr := flag.String("addr", "localhost:8740", "the address to listen on")
+	flag.Parse()
+
+	zlogger := zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.TimeOnly}).With().Timestamp().Logger()
+	if err := run(*configPath, *addr, logging.Zerolog(&zlogger)); err != nil {
+		zlogger.Fatal().Err(err).Msg("emulator failed")
+	}
+}
+
+func run(configPath, addr string, logger logging.Logger) error {
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	emuCfg := cfg.emulatorConfig()
+	emuCfg.Logger = logger
+	emu := emulator.New(emuCfg)
+	defer emu.Close()
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("unable to listen: %w", err)
+	}
+	srv := &http.Server{Handler: emu, ReadHeaderTimeout: 10 * time.Second}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("emulator listening, configure the SDK with platform.WithHost", "host", "http://"+ln.Addr().String())
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("unable to serve: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package encorecloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"go.encore.dev/platform-sdk/encorecloud/types"
+	"go.encore.dev/platform-sdk/internal/client"
+	"go.encore.dev/platform-sdk/pkg/auth"
+	"go.encore.dev/platform-sdk/pkg/metrics"
+)
+
+const (
+	// MaxBatchMessages is the maximum number of messages which can be published in a single batch.
+	MaxBatchMessages = 1000
+
+	// MaxBatchBytes is the maximum total size of the messages published in a single batch,
+	// counting their data, attributes, ordering keys and deduplication IDs.
+	MaxBatchBytes = 10 << 20
+)
+
+// ErrBatchTooLarge is returned by [Client.PublishBatch] when the batch exceeds
+// [MaxBatchMessages] or [MaxBatchBytes], in which case nothing is published.
+var ErrBatchTooLarge = errors.New("batch too large")
+
+// Message is a message to publish with [Client.PublishBatch].
+type Message struct {
+	OrderingKey string            // Optional grouping key, see [Client.PublishToTopic]
+	Attributes  map[string]string // Optional attributes
+	Data        []byte            // The JSON encoded payload
+	DeliverAt   time.Time         // Optional time to deliver the message at, see [DeliverAt]
+
+	// Optional ID to deduplicate the message with, see [WithDeduplicationID] and [ContentDeduplicationID]
+	DeduplicationID string
+}
+
+// size returns the number of bytes the message counts towards [MaxBatchBytes].
+func (m *Message) size() int {
+	size := len(m.OrderingKey) + len(m.Data) + len(m.DeduplicationID)
+	for k, v := range m.Attributes {
+		size += len(k) + len(v)
+	}
+	return size
+}
+
+// params returns the parameters to publish the message with.
+func (m *Message) params() *types.PublishParams {
+	params := &types.PublishParams{
+		OrderingKey:     m.OrderingKey,
+		Attributes:      m.Attributes,
+		Payload:         m.Data,
+		DeduplicationID: m.DeduplicationID,
+	}
+	if !m.DeliverAt.IsZero() {
+		deliverAt := m.DeliverAt.UTC()
+		params.DeliverAt = &deliverAt
+	}
+	return params
+}
+
+// BatchResult is the result of publishing a single message of a batch.
+type BatchResult struct {
+	MessageID string // The ID of the published message, if it was published
+	Duplicate bool   // Whether the message was a duplicate of one already published, whose ID is returned
+	Err       error  // Why the message was not published, if it wasn't
+}
+
+// PublishBatch publishes the messages to the topic specified by topicID in a single signed request,
+// which is much faster than calling [Client.PublishToTopic] for each of them.
+//
+// The batch is checked against [MaxBatchMessages] and [MaxBatchBytes] before it is sent, returning
+// an error wrapping [ErrBatchTooLarge] if it exceeds them, and each message is validated, returning
+// an error if any is invalid. Otherwise, if the request succeeds, it returns
+// a result for each message in the order they were given, as Encore Cloud may reject individual messages
+// while publishing the rest. An error is only returned if the batch as a whole failed, in which case
+// none of the messages were published.
+//
+// Messages with the same ordering key are delivered in the order they appear in the batch,
+// and if one of them is rejected, the ones after it are rejected too.
+func (c *Client) PublishBatch(ctx context.Context, topicID string, msgs []Message) (results []BatchResult, err error) {
+	if len(msgs) == 0 {
+		return nil, nil
+	} else if len(msgs) > MaxBatchMessages {
+		return nil, fmt.Errorf("%w: %d messages exceeds the limit of %d", ErrBatchTooLarge, len(msgs), MaxBatchMessages)
+	}
+	size := 0
+	for i := range msgs {
+		size += msgs[i].size()
+	}
+	if size > MaxBatchBytes {
+		return nil, fmt.Errorf("%w: %d bytes exceeds the limit of %d", ErrBatchTooLarge, size, MaxBatchBytes)
+	}
+
+	// Invalid messages are rejected before anything is traced or measured, as they are never sent
+	params := &types.PublishBatchParams{Messages: make([]*types.PublishParams, len(msgs))}
+	for i := range msgs {
+		params.Messages[i] = msgs[i].params()
+		if err := params.Messages[i].Validate(); err != nil {
+			return nil, fmt.Errorf("invalid message %d: %w", i, err)
+		}
+	}
+
+	// Every message is published with the trace context of the batch's span
+	ctx, span, traceAttrs := c.startPublishSpan(ctx, topicID, nil)
+	span.SetAttributes(attribute.Int("messaging.batch.message_count", len(msgs)))
+	defer func() { endSpan(span, err) }()
+
+	start := c.client.Clock().Now()
+	defer func() {
+		for i := range msgs {
+			outcome := client.OutcomeOf(err)
+			if err == nil && results[i].Err != nil {
+				outcome = metrics.ClientError
+			}
+			c.client.Metrics().ObservePublish(topicID, outcome, c.client.Clock().Since(start))
+		}
+	}()
+
+	if len(traceAttrs) > 0 {
+		for i, msg := range msgs {
+			attrs := make(map[string]string, len(msg.Attributes)+len(traceAttrs))
+			for k, v := range msg.Attributes {
+				attrs[k] = v
+			}
+			for k, v := range traceAttrs {
+				attrs[k] = v
+			}
+			params.Messages[i].Attributes = attrs
+		}
+	}
+	resp := &types.PublishBatchResponse{}
+
+	err = c.client.Do(ctx, client.SignedRequest{
+		Method:                http.MethodPost,
+		Path:                  fmt.Sprintf("/v1/pubsub/%s/publish-batch", url.PathEscape(topicID)),
+		PathTemplate:          "/v1/pubsub/{topic}/publish-batch",
+		Object:                auth.PubsubMsg,
+		Action:                auth.Create,
+		AdditionalAuthContext: [][]byte{[]byte(topicID)},
+		Payload:               params,
+		Response:              resp,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to publish batch: %w", err)
+	}
+	if len(resp.Results) != len(msgs) {
+		err = fmt.Errorf("unable to publish batch: got %d results for %d messages", len(resp.Results), len(msgs))
+		return nil, err
+	}
+
+	results = make([]BatchResult, len(msgs))
+	for i, result := range resp.Results {
+		switch {
+		case result == nil:
+			results[i].Err = errors.New("no result returned for message")
+		case result.Error != "":
+			results[i].Err = errors.New(result.Error)
+		default:
+			results[i].MessageID = result.MessageID
+			results[i].Duplicate = result.Duplicate
+		}
+	}
+	return results, nil
+}
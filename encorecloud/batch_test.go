@@ -0,0 +1,109 @@
+package encorecloud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	qt "github.com/frankban/quicktest"
+
+	"go.encore.dev/platform-sdk/encorecloud/types"
+	"go.encore.dev/platform-sdk/internal/client"
+	"go.encore.dev/platform-sdk/pkg/auth"
+)
+
+func TestPublishBatch(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	var requests atomic.Int32
+	platform := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+		c.Check(req.URL.Path, qt.Equals, "/v1/pubsub/my-topic/publish-batch")
+
+		opHash, err := auth.GetVerifiedOperationHash(req, []auth.Key{testKey}, clock.New())
+		c.Assert(err, qt.IsNil)
+		params := &types.PublishBatchParams{}
+		c.Assert(json.NewDecoder(req.Body).Decode(params), qt.IsNil)
+		valid, err := opHash.Verify(auth.PubsubMsg, auth.Create, params, []byte("my-topic"))
+		c.Assert(err, qt.IsNil)
+		c.Assert(valid, qt.IsTrue, qt.Commentf("the op hash should cover the whole batch"))
+
+		resp := &types.PublishBatchResponse{}
+		for i, msg := range params.Messages {
+			if string(msg.Payload) == `"bad"` {
+				resp.Results = append(resp.Results, &types.PublishBatchResult{Error: "invalid message"})
+			} else {
+				resp.Results = append(resp.Results, &types.PublishBatchResult{MessageID: "msg-" + string(rune('1'+i))})
+			}
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer platform.Close()
+
+	m := &recordingMetrics{}
+	cl := newTestClient(platform.URL, func(cfg *client.Config) { cfg.Metrics = m })
+
+	results, err := cl.PublishBatch(context.Background(), "my-topic", []Message{
+		{Data: []byte(`{"n":1}`), OrderingKey: "a"},
+		{Data: []byte(`"bad"`)},
+		{Data: []byte(`{"n":3}`), Attributes: map[string]string{"foo": "bar"}},
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(results, qt.HasLen, 3)
+	c.Assert(results[0], qt.DeepEquals, BatchResult{MessageID: "msg-1"})
+	c.Assert(results[1].Err, qt.ErrorMatches, "invalid message")
+	c.Assert(results[2], qt.DeepEquals, BatchResult{MessageID: "msg-3"})
+	c.Assert(requests.Load(), qt.Equals, int32(1))
+	c.Assert(m.publishes, qt.DeepEquals, []string{"my-topic success", "my-topic client_error", "my-topic success"})
+}
+
+func TestPublishBatch_Limits(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		msgs    []Message
+		wantErr string
+	}{
+		{
+			name:    "too many messages",
+			msgs:    make([]Message, MaxBatchMessages+1),
+			wantErr: "batch too large: 1001 messages exceeds the limit of 1000",
+		},
+		{
+			name: "too many bytes",
+			msgs: []Message{
+				{Data: []byte(strings.Repeat("x", MaxBatchBytes/2))},
+				{Data: []byte(strings.Repeat("x", MaxBatchBytes/2)), Attributes: map[string]string{"a": "b"}},
+			},
+			wantErr: "batch too large: 10485762 bytes exceeds the limit of 10485760",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := qt.New(t)
+
+			var requests atomic.Int32
+			platform := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				requests.Add(1)
+			}))
+			defer platform.Close()
+
+			results, err := newTestClient(platform.URL).PublishBatch(context.Background(), "my-topic", tt.msgs)
+			c.Assert(err, qt.ErrorMatches, tt.wantErr)
+			c.Assert(errors.Is(err, ErrBatchTooLarge), qt.IsTrue)
+			c.Assert(results, qt.IsNil)
+			c.Assert(requests.Load(), qt.Equals, int32(0), qt.Commentf("nothing should be sent"))
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package encorecloud
+
+import (
+	"context"
+
+	"go.encore.dev/platform-sdk/internal/client"
+)
+
+// APIError is returned when Encore Cloud responds to a request with an error.
+//
+// It can be extracted from the errors returned by the client using [errors.As],
+// allowing callers to tell apart failures such as a missing topic (404 Not Found),
+// an authentication failure (401 Unauthorized) or throttling (429 Too Many Requests).
+type APIError = client.APIError
+
+// ErrRateLimited is returned when a request is not sent because it would exceed the
+// client-side rate limit and the caller asked not to wait using [WithRateLimitWait].
+var ErrRateLimited = client.ErrRateLimited // nolint: gochecknoglobals
+
+// WithRateLimitWait returns a context which overrides whether requests made with it wait
+// for the client-side rate limit to allow them (wait = true), or fail immediately with
+// [ErrRateLimited] (wait = false).
+//
+// For example, to publish a message only if it can be published without waiting:
+//
+//	msgID, err := c.PublishToTopic(encorecloud.WithRateLimitWait(ctx, false), topicID, "", attrs, data)
+//	if errors.Is(err, encorecloud.ErrRateLimited) {
+//		// handle being rate limited
+//	}
+func WithRateLimitWait(ctx context.Context, wait bool) context.Context {
+	return client.WithRateLimitWait(ctx, wait)
+}
@@ -0,0 +1,77 @@
+package encorecloud
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.encore.dev/platform-sdk/encorecloud/types"
+)
+
+// RetryAfter wraps an error returned by a [types.SubscriptionCallback] to ask for the
+// message to be redelivered after the given delay, rather than on the platform's
+// retry schedule.
+//
+// It requires push version 2 or later, with earlier versions the message is nacked as usual.
+func RetryAfter(d time.Duration, err error) error {
+	return &retryAfterError{delay: d, err: err}
+}
+
+// Permanent wraps an error returned by a [types.SubscriptionCallback] to signal that
+// processing the message can never succeed, such that it is dead-lettered right away
+// rather than redelivered.
+//
+// It requires push version 2 or later. With earlier versions the message is nacked as usual, so it
+// is redelivered until the subscription's maximum number of delivery attempts is exhausted,
+// or indefinitely if the subscription doesn't limit delivery attempts.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+type retryAfterError struct {
+	delay time.Duration
+	err   error
+}
+
+func (e *retryAfterError) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("retry after %s", e.delay)
+	}
+	return e.err.Error()
+}
+
+func (e *retryAfterError) Unwrap() error {
+	return e.err
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	if e.err == nil {
+		return "permanent failure"
+	}
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// nackFor returns the nack to send for an error returned by a subscription callback.
+func nackFor(err error) *types.SubscriptionNack {
+	nack := &types.SubscriptionNack{Error: err.Error()}
+
+	var permanent *permanentError
+	var retryAfter *retryAfterError
+	if errors.As(err, &permanent) {
+		nack.Permanent = true
+	} else if errors.As(err, &retryAfter) && retryAfter.delay > 0 {
+		nack.RetryAfterMillis = retryAfter.delay.Milliseconds()
+		if nack.RetryAfterMillis == 0 {
+			nack.RetryAfterMillis = 1
+		}
+	}
+	return nack
+}
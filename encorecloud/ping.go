@@ -0,0 +1,160 @@
+package encorecloud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.encore.dev/platform-sdk/encorecloud/types"
+	"go.encore.dev/platform-sdk/internal/client"
+	"go.encore.dev/platform-sdk/pkg/auth"
+)
+
+// MaxClockSkew is the largest difference between the local clock and the clock of
+// Encore Cloud for which signed requests are accepted.
+const MaxClockSkew = 2 * time.Minute
+
+// ConnectivityReport describes the result of checking connectivity with Encore Cloud.
+type ConnectivityReport struct {
+	Latency           time.Duration `json:"latency"`             // The round trip time of the ping
+	ClockSkew         time.Duration `json:"clock_skew"`          // How far the server's clock is ahead of the local clock (negative if behind)
+	ClockSkewExceeded bool          `json:"clock_skew_exceeded"` // Whether the clock skew exceeds MaxClockSkew
+	KeyID             uint32        `json:"key_id"`              // The ID of the key the ping was signed with
+	KeyAccepted       bool          `json:"key_accepted"`        // Whether the server accepted the signature of the ping
+	APIVersions       []string      `json:"api_versions"`        // The API versions supported by the server
+}
+
+// CheckConnectivity makes a cheap signed round trip to Encore Cloud, returning a report
+// describing the connection.
+//
+// An error is returned if Encore Cloud can't be reached, if it rejects the signature of the
+// request, or if the clock skew exceeds [MaxClockSkew] (in which case requests are, or will soon
+// start to be, rejected). The report is returned alongside the error whenever a response was
+// received, so for instance a rejected signing key can be told apart from the server being
+// unreachable, or from a signature rejected because of clock skew.
+//
+// The request is not retried, and bypasses the client's circuit breaker and rate limit, so the
+// check fails promptly when Encore Cloud is unavailable and succeeds as soon as it is available.
+func (c *Client) CheckConnectivity(ctx context.Context) (*ConnectivityReport, error) {
+	report := &ConnectivityReport{KeyID: c.client.SigningKeyID()}
+	received := false
+
+	var serverDate time.Time
+	ctx = client.WithProbe(client.WithoutRetries(ctx), &serverDate)
+
+	clock := c.client.Clock()
+	start := clock.Now()
+	err := c.client.Do(ctx, client.SignedRequest{
+		Method: http.MethodGet,
+		Path:   "/v1/ping",
+		Object: auth.Ping,
+		Action: auth.Read,
+		Decode: func(resp *http.Response) error {
+			// The server verified the signature to respond successfully, whatever the body
+			received = true
+			report.Latency = clock.Since(start)
+			report.KeyAccepted = true
+
+			var pingResp types.PingResponse
+			if err := json.NewDecoder(resp.Body).Decode(&pingResp); err != nil {
+				return fmt.Errorf("%w: %w", errInvalidPingResponse, err)
+			}
+			report.APIVersions = pingResp.APIVersions
+
+			if !pingResp.ServerTime.IsZero() {
+				// Prefer the server time of the response over the less precise Date header
+				serverDate = pingResp.ServerTime
+			}
+			return nil
+		},
+	})
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		// The server responded, but without a successful response there's nothing to report
+		// beyond whether the signature was accepted and the clock skew
+		received = true
+		report.Latency = clock.Since(start)
+		report.KeyAccepted = apiErr.StatusCode != http.StatusUnauthorized && apiErr.StatusCode != http.StatusForbidden
+	}
+
+	if received && !serverDate.IsZero() {
+		// Assume the server handled the ping half way through the round trip
+		report.ClockSkew = serverDate.Sub(start.Add(report.Latency / 2))
+		report.ClockSkewExceeded = report.ClockSkew > MaxClockSkew || report.ClockSkew < -MaxClockSkew
+	}
+
+	switch {
+	case err != nil && !received:
+		return nil, fmt.Errorf("unable to reach Encore Cloud: %w", err)
+	case report.ClockSkewExceeded:
+		// A rejected signature is most likely caused by the skew rather than the key
+		return report, fmt.Errorf("clock skew of %s exceeds the maximum of %s", report.ClockSkew, MaxClockSkew)
+	case err != nil:
+		return report, fmt.Errorf("ping failed: %w", err)
+	default:
+		return report, nil
+	}
+}
+
+// errInvalidPingResponse is returned by [Client.CheckConnectivity] when the ping succeeds
+// but its response can't be decoded.
+var errInvalidPingResponse = errors.New("unable to decode ping response")
+
+// Reasons reported by [Client.ConnectivityHandler] for failed connectivity checks.
+const (
+	ConnectivityUnreachable     = "unreachable"      // Encore Cloud could not be reached
+	ConnectivityClockSkew       = "clock_skew"       // The clock skew exceeds MaxClockSkew
+	ConnectivityKeyRejected     = "key_rejected"     // Encore Cloud rejected the signing key
+	ConnectivityInvalidResponse = "invalid_response" // Encore Cloud accepted the ping, but its response couldn't be decoded
+	ConnectivityPingFailed      = "ping_failed"      // Encore Cloud failed the ping for another reason
+)
+
+// connectivityReason returns the reason reported by [Client.ConnectivityHandler] for a check
+// which failed with err.
+func connectivityReason(report *ConnectivityReport, err error) string {
+	switch {
+	case report == nil:
+		return ConnectivityUnreachable
+	case report.ClockSkewExceeded:
+		return ConnectivityClockSkew
+	case !report.KeyAccepted:
+		return ConnectivityKeyRejected
+	case errors.Is(err, errInvalidPingResponse):
+		return ConnectivityInvalidResponse
+	default:
+		return ConnectivityPingFailed
+	}
+}
+
+// ConnectivityHandler returns a [http.Handler] which checks connectivity with Encore Cloud
+// using [Client.CheckConnectivity], making it easy to mount as a readiness probe.
+//
+// It responds with 200 OK if the check succeeds, and 503 Service Unavailable if it fails. As
+// probes are unauthenticated the JSON body only says whether the check succeeded and, if not,
+// one of the generic connectivity reasons such as [ConnectivityUnreachable]; the details of a
+// failure are logged instead.
+func (c *Client) ConnectivityHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		report, err := c.CheckConnectivity(req.Context())
+
+		body := struct {
+			Healthy bool   `json:"healthy"`
+			Reason  string `json:"reason,omitempty"`
+		}{Healthy: err == nil}
+		status := http.StatusOK
+		if err != nil {
+			body.Reason = connectivityReason(report, err)
+			status = http.StatusServiceUnavailable
+			c.client.Logger().Warn("Encore Cloud connectivity check failed", "reason", body.Reason, "error", err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(body)
+	})
+}
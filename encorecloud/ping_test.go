@@ -0,0 +1,214 @@
+package encorecloud
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	qt "github.com/frankban/quicktest"
+
+	"go.encore.dev/platform-sdk/encorecloud/types"
+	"go.encore.dev/platform-sdk/pkg/auth"
+)
+
+// newPingServer returns a server which responds to pings as Encore Cloud would,
+// with its clock offset from the local clock by skew. If malformed is set, it responds
+// to valid pings with a body which isn't a ping response.
+func newPingServer(t *testing.T, keys []auth.Key, skew time.Duration, malformed bool) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet || req.URL.Path != "/v1/ping" {
+			http.NotFound(w, req)
+			return
+		}
+		serverClock := clock.NewMock()
+		serverClock.Set(time.Now().Add(skew))
+		w.Header().Set("Date", serverClock.Now().UTC().Format(http.TimeFormat))
+
+		opHash, err := auth.GetVerifiedOperationHash(req, keys, serverClock)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if ok, err := opHash.Verify(auth.Ping, auth.Read, nil); err != nil || !ok {
+			http.Error(w, "invalid operation hash", http.StatusUnauthorized)
+			return
+		}
+
+		if malformed {
+			_, _ = w.Write([]byte("<html>pong</html>"))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(&types.PingResponse{
+			ServerTime:  serverClock.Now(),
+			APIVersions: []string{"v1"},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCheckConnectivity(t *testing.T) {
+	t.Parallel()
+
+	otherKey := auth.Key{KeyID: 2, Data: []byte("other-key-data")}
+
+	tests := []struct {
+		name                  string
+		keys                  []auth.Key
+		skew                  time.Duration
+		unreachable           bool
+		malformed             bool
+		wantErr               string
+		wantNoReport          bool
+		wantKeyAccepted       bool
+		wantClockSkewExceeded bool
+	}{
+		{
+			name:            "ok",
+			keys:            []auth.Key{testKey},
+			skew:            time.Minute,
+			wantKeyAccepted: true,
+		},
+		{
+			name:                  "excessive clock skew",
+			keys:                  []auth.Key{testKey},
+			skew:                  -5 * time.Minute,
+			wantErr:               "clock skew of -[45]m.* exceeds the maximum of 2m0s",
+			wantClockSkewExceeded: true,
+		},
+		{
+			name:    "key rejected",
+			keys:    []auth.Key{otherKey},
+			skew:    time.Minute,
+			wantErr: "ping failed: unexpected response status 401 .*",
+		},
+		{
+			name:            "malformed response",
+			keys:            []auth.Key{testKey},
+			skew:            time.Minute,
+			malformed:       true,
+			wantErr:         "ping failed: failed to decode response: unable to decode ping response: .*",
+			wantKeyAccepted: true,
+		},
+		{
+			name:         "unreachable",
+			keys:         []auth.Key{testKey},
+			unreachable:  true,
+			wantErr:      "unable to reach Encore Cloud: .*",
+			wantNoReport: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := qt.New(t)
+
+			srv := newPingServer(t, tt.keys, tt.skew, tt.malformed)
+			if tt.unreachable {
+				srv.Close()
+			}
+
+			report, err := newTestClient(srv.URL).CheckConnectivity(context.Background())
+			if tt.wantErr != "" {
+				c.Assert(err, qt.ErrorMatches, tt.wantErr)
+			} else {
+				c.Assert(err, qt.IsNil)
+			}
+			if tt.wantNoReport {
+				c.Assert(report, qt.IsNil)
+				return
+			}
+
+			c.Assert(report.KeyID, qt.Equals, testKey.KeyID)
+			c.Assert(report.KeyAccepted, qt.Equals, tt.wantKeyAccepted)
+			c.Assert(report.ClockSkewExceeded, qt.Equals, tt.wantClockSkewExceeded)
+			c.Assert(report.Latency > 0, qt.IsTrue)
+			if tt.wantKeyAccepted && !tt.malformed {
+				c.Assert(report.APIVersions, qt.DeepEquals, []string{"v1"})
+				c.Assert((report.ClockSkew-tt.skew).Abs() < time.Second, qt.IsTrue, qt.Commentf("clock skew %s", report.ClockSkew))
+			} else {
+				// Without a valid ping response the skew is only known to the precision of the Date header
+				c.Assert((report.ClockSkew-tt.skew).Abs() < 2*time.Second, qt.IsTrue, qt.Commentf("clock skew %s", report.ClockSkew))
+			}
+		})
+	}
+}
+
+func TestConnectivityHandler(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		keys        []auth.Key
+		skew        time.Duration
+		unreachable bool
+		malformed   bool
+		wantStatus  int
+		wantReason  string
+	}{
+		{
+			name:       "healthy",
+			keys:       []auth.Key{testKey},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "unreachable",
+			keys:        []auth.Key{testKey},
+			unreachable: true,
+			wantStatus:  http.StatusServiceUnavailable,
+			wantReason:  ConnectivityUnreachable,
+		},
+		{
+			name:       "clock skew",
+			keys:       []auth.Key{testKey},
+			skew:       5 * time.Minute,
+			wantStatus: http.StatusServiceUnavailable,
+			wantReason: ConnectivityClockSkew,
+		},
+		{
+			name:       "key rejected",
+			keys:       []auth.Key{{KeyID: 2, Data: []byte("other-key-data")}},
+			wantStatus: http.StatusServiceUnavailable,
+			wantReason: ConnectivityKeyRejected,
+		},
+		{
+			name:       "malformed response",
+			keys:       []auth.Key{testKey},
+			malformed:  true,
+			wantStatus: http.StatusServiceUnavailable,
+			wantReason: ConnectivityInvalidResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := qt.New(t)
+
+			srv := newPingServer(t, tt.keys, tt.skew, tt.malformed)
+			if tt.unreachable {
+				srv.Close()
+			}
+
+			rec := httptest.NewRecorder()
+			newTestClient(srv.URL).ConnectivityHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			c.Assert(rec.Code, qt.Equals, tt.wantStatus)
+
+			// Only the outcome is exposed to the unauthenticated caller
+			var body map[string]any
+			c.Assert(json.Unmarshal(rec.Body.Bytes(), &body), qt.IsNil)
+			want := map[string]any{"healthy": tt.wantReason == ""}
+			if tt.wantReason != "" {
+				want["reason"] = tt.wantReason
+			}
+			c.Assert(body, qt.DeepEquals, want)
+		})
+	}
+}
@@ -0,0 +1,449 @@
+package encorecloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+var (
+	// ErrFlowControlLimitExceeded is returned by [Publisher.Publish] when publishing the message would
+	// exceed the publisher's flow control limits and it is configured with [FlowControlError].
+	ErrFlowControlLimitExceeded = errors.New("publisher flow control limit exceeded")
+
+	// ErrPublisherStopped is returned by [Publisher.Publish] once the publisher has been stopped.
+	ErrPublisherStopped = errors.New("publisher stopped")
+
+	// ErrOrderingKeyPaused is returned by [Publisher.Publish] for messages with an ordering key
+	// which has been paused after failing to publish, until [Publisher.ResumePublish] is called.
+	ErrOrderingKeyPaused = errors.New("ordering key paused")
+)
+
+// FlowControlBehavior is what a [Publisher] does when publishing a message would exceed its flow control limits.
+type FlowControlBehavior int
+
+const (
+	FlowControlBlock FlowControlBehavior = iota // Wait for outstanding messages to be published
+	FlowControlError                            // Fail with ErrFlowControlLimitExceeded
+)
+
+// PublisherConfig configures a [Publisher].
+type PublisherConfig struct {
+	CountThreshold int           // The number of buffered messages which triggers a flush (defaults to 100, at most MaxBatchMessages)
+	ByteThreshold  int           // The size of the buffered messages which triggers a flush (defaults to 1MiB, at most MaxBatchBytes)
+	DelayThreshold time.Duration // How long a message may be buffered before it is flushed (defaults to 10ms)
+
+	MaxOutstandingMessages int                 // The maximum number of messages buffered or being sent (defaults to 1000)
+	MaxOutstandingBytes    int                 // The maximum size of the messages buffered or being sent (defaults to 100MiB)
+	LimitExceededBehavior  FlowControlBehavior // What to do when publishing would exceed the limits (defaults to FlowControlBlock)
+
+	// EnableMessageOrdering publishes messages with the same ordering key one batch at a time, in the order
+	// they were given to [Publisher.Publish], pausing the key if a publish fails (see [Publisher.ResumePublish]).
+	EnableMessageOrdering bool
+}
+
+func (cfg PublisherConfig) withDefaults() PublisherConfig {
+	if cfg.CountThreshold <= 0 {
+		cfg.CountThreshold = 100
+	}
+	if cfg.CountThreshold > MaxBatchMessages {
+		cfg.CountThreshold = MaxBatchMessages
+	}
+	if cfg.ByteThreshold <= 0 {
+		cfg.ByteThreshold = 1 << 20
+	}
+	if cfg.ByteThreshold > MaxBatchBytes {
+		cfg.ByteThreshold = MaxBatchBytes
+	}
+	if cfg.DelayThreshold <= 0 {
+		cfg.DelayThreshold = 10 * time.Millisecond
+	}
+	if cfg.MaxOutstandingMessages <= 0 {
+		cfg.MaxOutstandingMessages = 1000
+	}
+	if cfg.MaxOutstandingBytes <= 0 {
+		cfg.MaxOutstandingBytes = 100 << 20
+	}
+	return cfg
+}
+
+// PublishResult is the eventual result of a message published with [Publisher.Publish].
+type PublishResult struct {
+	done  chan struct{}
+	msgID string
+	err   error
+}
+
+func newPublishResult() *PublishResult {
+	return &PublishResult{done: make(chan struct{})}
+}
+
+// failedPublishResult returns a result which has already failed with err.
+func failedPublishResult(err error) *PublishResult {
+	r := newPublishResult()
+	r.set("", err)
+	return r
+}
+
+func (r *PublishResult) set(msgID string, err error) {
+	r.msgID, r.err = msgID, err
+	close(r.done)
+}
+
+// Ready returns a channel which is closed once the result is available.
+func (r *PublishResult) Ready() <-chan struct{} {
+	return r.done
+}
+
+// Get waits for the message to be published, returning its message ID, or the error
+// which prevented it from being published. It returns the context's error if the
+// context is done first, in which case the message may still be published.
+func (r *PublishResult) Get(ctx context.Context) (msgID string, err error) {
+	select {
+	case <-r.done:
+		return r.msgID, r.err
+	case <-ctx.Done():
+		return "", ctx.Err() // nolint: wrapcheck
+	}
+}
+
+// bufferedMessage is a message waiting to be sent by a [Publisher].
+type bufferedMessage struct {
+	msg    Message
+	size   int
+	result *PublishResult
+}
+
+// Publisher publishes messages to a topic asynchronously, buffering them in memory and
+// sending them in batches using [Client.PublishBatch] once enough messages have been
+// buffered or the oldest has waited long enough. This takes the latency of publishing
+// out of the caller's path, at the cost of messages being lost if the process exits
+// before they are sent.
+//
+// Batches are sent concurrently, so messages with the same ordering key are not guaranteed
+// to be published in the order [Publisher.Publish] was called unless the publisher is configured
+// with EnableMessageOrdering. In that case, the messages for each ordering key are sent one batch at
+// a time, and if a message fails to publish its ordering key is paused: the messages buffered for
+// the key and any published afterwards fail with [ErrOrderingKeyPaused] until
+// [Publisher.ResumePublish] is called, so that a later message is never published before an
+// earlier one which failed.
+//
+// A Publisher is safe for concurrent use, and must be stopped with [Publisher.Stop]
+// to ensure all the messages are published.
+type Publisher struct {
+	client  *Client
+	topicID string
+	cfg     PublisherConfig
+	clock   clock.Clock
+
+	mu           sync.Mutex
+	stopped      bool
+	buffer       []*bufferedMessage           // the unordered messages waiting to be sent
+	orderingKeys map[string]*orderingKeyState // the state of the ordering keys with messages waiting, being sent or paused
+	bufferCount  int                          // the number of messages waiting to be sent
+	bufferBytes  int                          // the size of the messages waiting to be sent
+	flushTimer   *clock.Timer
+	sending      int           // the number of batches being sent
+	idle         chan struct{} // closed once no batches are being sent
+
+	// Flow control, guarded by mu
+	outstandingMessages int
+	outstandingBytes    int
+	released            chan struct{} // closed and replaced whenever outstanding messages complete
+}
+
+// NewPublisher creates a [Publisher] for the topic specified by topicID.
+func (c *Client) NewPublisher(topicID string, cfg PublisherConfig) *Publisher {
+	return &Publisher{
+		client:       c,
+		topicID:      topicID,
+		cfg:          cfg.withDefaults(),
+		clock:        c.client.Clock(),
+		orderingKeys: make(map[string]*orderingKeyState),
+		idle:         closedChan(),
+		released:     make(chan struct{}),
+	}
+}
+
+// orderingKeyState is the state of an ordering key of a [Publisher] with message ordering enabled.
+type orderingKeyState struct {
+	queue   []*bufferedMessage // the messages waiting to be sent, in order
+	sending bool               // whether a batch of messages for the key is being sent
+	err     error              // why the key was paused, if it is
+}
+
+// Publish buffers the message to be published, returning a result which can be used to
+// wait for it to be published.
+//
+// If publishing the message would exceed the flow control limits, it either waits
+// until enough outstanding messages have been published or fails with
+// [ErrFlowControlLimitExceeded], depending on the configured [FlowControlBehavior].
+// If message ordering is enabled and the message's ordering key is paused, it fails
+// with [ErrOrderingKeyPaused]. Invalid messages fail right away, without affecting the
+// messages they would have been batched with. Either way, any error is returned through
+// the result.
+func (p *Publisher) Publish(ctx context.Context, msg Message) *PublishResult {
+	size := msg.size()
+	if size > MaxBatchBytes {
+		return failedPublishResult(fmt.Errorf("%w: message of %d bytes exceeds the limit of %d", ErrBatchTooLarge, size, MaxBatchBytes))
+	}
+	if err := msg.params().Validate(); err != nil {
+		return failedPublishResult(fmt.Errorf("invalid message: %w", err))
+	}
+
+	ordered := p.cfg.EnableMessageOrdering && msg.OrderingKey != ""
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.pausedErrLocked(msg.OrderingKey); ordered && err != nil {
+		return failedPublishResult(err)
+	}
+	if err := p.acquireLocked(ctx, size); err != nil {
+		return failedPublishResult(err)
+	}
+	// The key may have been paused while waiting for flow control
+	if err := p.pausedErrLocked(msg.OrderingKey); ordered && err != nil {
+		p.releaseLocked(1, size)
+		return failedPublishResult(err)
+	}
+
+	buffered := &bufferedMessage{msg: msg, size: size, result: newPublishResult()}
+	if ordered {
+		state := p.orderingKeys[msg.OrderingKey]
+		if state == nil {
+			state = &orderingKeyState{}
+			p.orderingKeys[msg.OrderingKey] = state
+		}
+		state.queue = append(state.queue, buffered)
+	} else {
+		p.buffer = append(p.buffer, buffered)
+	}
+	p.bufferCount++
+	p.bufferBytes += size
+
+	switch {
+	case p.bufferCount >= p.cfg.CountThreshold || p.bufferBytes >= p.cfg.ByteThreshold:
+		p.flushLocked()
+	case p.flushTimer == nil:
+		p.flushTimer = p.clock.AfterFunc(p.cfg.DelayThreshold, func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.flushLocked()
+		})
+	}
+	return buffered.result
+}
+
+// pausedErrLocked returns the error to fail messages for the ordering key with if it is paused,
+// the caller must hold p.mu.
+func (p *Publisher) pausedErrLocked(orderingKey string) error {
+	if state := p.orderingKeys[orderingKey]; state != nil && state.err != nil {
+		return fmt.Errorf("%w: %q after an earlier message failed to publish: %v", ErrOrderingKeyPaused, orderingKey, state.err)
+	}
+	return nil
+}
+
+// ResumePublish resumes publishing messages with the ordering key after it has been paused
+// because a message failed to publish. It does nothing if the key is not paused.
+func (p *Publisher) ResumePublish(orderingKey string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if state := p.orderingKeys[orderingKey]; state != nil && state.err != nil {
+		delete(p.orderingKeys, orderingKey)
+	}
+}
+
+// acquireLocked reserves room for a message of the given size within the flow control
+// limits, waiting for it if configured to. The caller must hold p.mu, which is
+// released while waiting.
+func (p *Publisher) acquireLocked(ctx context.Context, size int) error {
+	if size > p.cfg.MaxOutstandingBytes {
+		return fmt.Errorf("%w: message of %d bytes exceeds the limit of %d outstanding bytes", ErrFlowControlLimitExceeded, size, p.cfg.MaxOutstandingBytes)
+	}
+
+	for {
+		if p.stopped {
+			return ErrPublisherStopped
+		}
+		if p.outstandingMessages+1 <= p.cfg.MaxOutstandingMessages && p.outstandingBytes+size <= p.cfg.MaxOutstandingBytes {
+			p.outstandingMessages++
+			p.outstandingBytes += size
+			return nil
+		}
+		if p.cfg.LimitExceededBehavior == FlowControlError {
+			return ErrFlowControlLimitExceeded
+		}
+
+		released := p.released
+		p.mu.Unlock()
+		select {
+		case <-released:
+			p.mu.Lock()
+		case <-ctx.Done():
+			p.mu.Lock()
+			return ctx.Err() // nolint: wrapcheck
+		}
+	}
+}
+
+// releaseLocked returns the room reserved by messages which have completed to the
+// flow control limits, the caller must hold p.mu.
+func (p *Publisher) releaseLocked(messages, bytes int) {
+	p.outstandingMessages -= messages
+	p.outstandingBytes -= bytes
+	close(p.released)
+	p.released = make(chan struct{})
+}
+
+// flushLocked starts sending the buffered messages, the caller must hold p.mu.
+//
+// Messages for ordering keys which are already being sent stay buffered until
+// the batch being sent completes.
+func (p *Publisher) flushLocked() {
+	if p.flushTimer != nil {
+		p.flushTimer.Stop()
+		p.flushTimer = nil
+	}
+
+	for len(p.buffer) > 0 {
+		var batch []*bufferedMessage
+		batch, p.buffer = p.takeBatchLocked(p.buffer)
+		p.sendLocked("", batch)
+	}
+	for key, state := range p.orderingKeys {
+		if !state.sending && state.err == nil && len(state.queue) > 0 {
+			p.sendNextLocked(key, state)
+		}
+	}
+}
+
+// sendNextLocked starts sending the next batch of messages for the ordering key,
+// the caller must hold p.mu.
+func (p *Publisher) sendNextLocked(key string, state *orderingKeyState) {
+	var batch []*bufferedMessage
+	batch, state.queue = p.takeBatchLocked(state.queue)
+	state.sending = true
+	p.sendLocked(key, batch)
+}
+
+// takeBatchLocked splits the first batch of messages that fits within [MaxBatchMessages]
+// and [MaxBatchBytes] off the queue, the caller must hold p.mu.
+func (p *Publisher) takeBatchLocked(queue []*bufferedMessage) (batch, rest []*bufferedMessage) {
+	n, size := 0, 0
+	for n < len(queue) && n < MaxBatchMessages && (n == 0 || size+queue[n].size <= MaxBatchBytes) {
+		size += queue[n].size
+		n++
+	}
+	p.bufferCount -= n
+	p.bufferBytes -= size
+	return queue[:n:n], queue[n:]
+}
+
+// sendLocked starts sending a batch of messages, the caller must hold p.mu.
+func (p *Publisher) sendLocked(orderingKey string, batch []*bufferedMessage) {
+	if p.sending == 0 {
+		p.idle = make(chan struct{})
+	}
+	p.sending++
+	go p.send(orderingKey, batch)
+}
+
+// send publishes a batch of messages, sets their results and, if the messages
+// have an ordering key, starts sending the next batch for it.
+func (p *Publisher) send(orderingKey string, batch []*bufferedMessage) {
+	msgs := make([]Message, len(batch))
+	for i, buffered := range batch {
+		msgs[i] = buffered.msg
+	}
+
+	// The batch isn't tied to the context of any one caller
+	results, err := p.client.PublishBatch(context.Background(), p.topicID, msgs)
+	var firstErr error
+	for i, buffered := range batch {
+		msgID, msgErr := "", err
+		if err == nil {
+			msgID, msgErr = results[i].MessageID, results[i].Err
+		}
+		buffered.result.set(msgID, msgErr)
+		if firstErr == nil {
+			firstErr = msgErr
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	completed, completedBytes := len(batch), 0
+	for _, buffered := range batch {
+		completedBytes += buffered.size
+	}
+
+	if state := p.orderingKeys[orderingKey]; orderingKey != "" && state != nil {
+		state.sending = false
+		switch {
+		case firstErr != nil:
+			// Pause the key, failing the messages waiting to be sent
+			state.err = firstErr
+			pausedErr := p.pausedErrLocked(orderingKey)
+			for _, buffered := range state.queue {
+				buffered.result.set("", pausedErr)
+				completed++
+				completedBytes += buffered.size
+				p.bufferCount--
+				p.bufferBytes -= buffered.size
+			}
+			state.queue = nil
+		case len(state.queue) > 0:
+			p.sendNextLocked(orderingKey, state)
+		default:
+			delete(p.orderingKeys, orderingKey)
+		}
+	}
+
+	p.releaseLocked(completed, completedBytes)
+	p.sending--
+	if p.sending == 0 {
+		close(p.idle)
+	}
+}
+
+// Flush sends the buffered messages immediately and waits for every message
+// published so far to have been sent, or for the context to be done.
+func (p *Publisher) Flush(ctx context.Context) error {
+	p.mu.Lock()
+	p.flushLocked()
+	idle := p.idle
+	p.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err() // nolint: wrapcheck
+	}
+}
+
+// Stop stops the publisher from accepting new messages and flushes the messages
+// already published, see [Publisher.Flush]. Publishes waiting for flow control fail
+// with [ErrPublisherStopped].
+func (p *Publisher) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.stopped {
+		p.stopped = true
+		close(p.released)
+		p.released = make(chan struct{})
+	}
+	p.mu.Unlock()
+
+	return p.Flush(ctx)
+}
+
+// closedChan returns a channel which is already closed.
+func closedChan() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
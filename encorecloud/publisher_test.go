@@ -0,0 +1,305 @@
+package encorecloud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"go.encore.dev/platform-sdk/encorecloud/types"
+	"go.encore.dev/platform-sdk/internal/client"
+)
+
+// batchServer is a fake Encore Cloud which records the batches published to it.
+type batchServer struct {
+	*httptest.Server
+	status  int           // the status to fail batches with, if non-zero
+	release chan struct{} // if set, batches wait for it to be closed
+
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func newBatchServer(c *qt.C) *batchServer {
+	s := &batchServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if s.release != nil {
+			<-s.release
+		}
+		if s.status != 0 {
+			http.Error(w, `{"code": "invalid_argument", "message": "rejected"}`, s.status)
+			return
+		}
+
+		params := &types.PublishBatchParams{}
+		c.Check(json.NewDecoder(req.Body).Decode(params), qt.IsNil)
+		resp := &types.PublishBatchResponse{}
+		var batch []string
+		for _, msg := range params.Messages {
+			batch = append(batch, string(msg.Payload))
+			resp.Results = append(resp.Results, &types.PublishBatchResult{MessageID: "id-" + string(msg.Payload)})
+		}
+		s.mu.Lock()
+		s.batches = append(s.batches, batch)
+		s.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	c.Cleanup(s.Close)
+	return s
+}
+
+// published returns the batches published, ordered by their first message
+// as they may be sent concurrently.
+func (s *batchServer) published() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batches := append([][]string(nil), s.batches...)
+	sort.Slice(batches, func(i, j int) bool { return batches[i][0] < batches[j][0] })
+	return batches
+}
+
+func TestPublisher_Thresholds(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	srv := newBatchServer(c)
+	p := newTestClient(srv.URL).NewPublisher("my-topic", PublisherConfig{
+		CountThreshold: 3,
+		ByteThreshold:  10,
+		DelayThreshold: time.Hour,
+	})
+
+	// The count threshold is hit after 3 messages, and the byte threshold with the fifth
+	payloads := []string{"1", "2", "3", "4", `"long-one"`, "6"}
+	var results []*PublishResult
+	for _, data := range payloads {
+		results = append(results, p.Publish(ctx, Message{Data: []byte(data)}))
+	}
+	for _, result := range results[:5] {
+		<-result.Ready()
+	}
+	c.Assert(srv.published(), qt.DeepEquals, [][]string{{"1", "2", "3"}, {"4", `"long-one"`}})
+
+	// The last message is only sent once flushed
+	select {
+	case <-results[5].Ready():
+		c.Fatal("message sent before the publisher was flushed")
+	default:
+	}
+	c.Assert(p.Stop(ctx), qt.IsNil)
+	c.Assert(srv.published(), qt.HasLen, 3)
+	c.Assert(srv.published()[2], qt.DeepEquals, []string{"6"})
+
+	for i, result := range results {
+		msgID, err := result.Get(ctx)
+		c.Assert(err, qt.IsNil)
+		c.Assert(msgID, qt.Equals, "id-"+payloads[i])
+	}
+	_, err := p.Publish(ctx, Message{Data: []byte("7")}).Get(ctx)
+	c.Assert(err, qt.Equals, ErrPublisherStopped)
+}
+
+func TestPublisher_DelayThreshold(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	srv := newBatchServer(c)
+	p := newTestClient(srv.URL).NewPublisher("my-topic", PublisherConfig{DelayThreshold: time.Millisecond})
+	defer func() { _ = p.Stop(ctx) }()
+
+	msgID, err := p.Publish(ctx, Message{Data: []byte("1")}).Get(ctx)
+	c.Assert(err, qt.IsNil)
+	c.Assert(msgID, qt.Equals, "id-1")
+}
+
+func TestPublisher_FlowControl(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		behavior FlowControlBehavior
+		wantErr  string
+	}{
+		{name: "block", behavior: FlowControlBlock, wantErr: "context deadline exceeded"},
+		{name: "error", behavior: FlowControlError, wantErr: "publisher flow control limit exceeded"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := qt.New(t)
+			ctx := context.Background()
+
+			srv := newBatchServer(c)
+			srv.release = make(chan struct{})
+			p := newTestClient(srv.URL).NewPublisher("my-topic", PublisherConfig{
+				CountThreshold:         1,
+				MaxOutstandingMessages: 2,
+				LimitExceededBehavior:  tt.behavior,
+			})
+
+			first := p.Publish(ctx, Message{Data: []byte("1")})
+			second := p.Publish(ctx, Message{Data: []byte("2")})
+
+			// Both messages are outstanding until the server responds
+			timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+			defer cancel()
+			_, err := p.Publish(timeoutCtx, Message{Data: []byte("3")}).Get(ctx)
+			c.Assert(err, qt.ErrorMatches, tt.wantErr)
+
+			// Once they've been published, there is room again
+			close(srv.release)
+			for _, result := range []*PublishResult{first, second} {
+				_, err := result.Get(ctx)
+				c.Assert(err, qt.IsNil)
+			}
+			msgID, err := p.Publish(ctx, Message{Data: []byte("4")}).Get(ctx)
+			c.Assert(err, qt.IsNil)
+			c.Assert(msgID, qt.Equals, "id-4")
+			c.Assert(p.Stop(ctx), qt.IsNil)
+		})
+	}
+}
+
+func TestPublisher_BatchFailure(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	srv := newBatchServer(c)
+	srv.status = http.StatusBadRequest
+	p := newTestClient(srv.URL, func(cfg *client.Config) { cfg.Retry = client.RetryPolicy{MaxAttempts: 1} }).
+		NewPublisher("my-topic", PublisherConfig{})
+
+	var results []*PublishResult
+	for i := 0; i < 3; i++ {
+		results = append(results, p.Publish(ctx, Message{Data: []byte(fmt.Sprint(i))}))
+	}
+	c.Assert(p.Flush(ctx), qt.IsNil)
+
+	// Every message of the batch fails with the error
+	for _, result := range results {
+		_, err := result.Get(ctx)
+		var apiErr *APIError
+		c.Assert(errors.As(err, &apiErr), qt.IsTrue)
+		c.Assert(apiErr.StatusCode, qt.Equals, http.StatusBadRequest)
+	}
+}
+
+func TestPublisher_InvalidMessage(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	srv := newBatchServer(c)
+	p := newTestClient(srv.URL).NewPublisher("my-topic", PublisherConfig{EnableMessageOrdering: true, DelayThreshold: time.Hour})
+
+	// The invalid message fails on its own, without failing the messages it would have been
+	// batched with or pausing their ordering key
+	results := []*PublishResult{
+		p.Publish(ctx, Message{OrderingKey: "k", Data: []byte("1")}),
+		p.Publish(ctx, Message{OrderingKey: "k", Data: []byte("2"), DeduplicationID: strings.Repeat("a", types.MaxDeduplicationIDLength+1)}),
+		p.Publish(ctx, Message{OrderingKey: "k", Data: []byte("3")}),
+	}
+	_, err := results[1].Get(ctx)
+	c.Assert(err, qt.ErrorMatches, "invalid message: deduplication ID must be at most 128 characters")
+
+	c.Assert(p.Flush(ctx), qt.IsNil)
+	for _, i := range []int{0, 2} {
+		msgID, err := results[i].Get(ctx)
+		c.Assert(err, qt.IsNil)
+		c.Assert(msgID, qt.Equals, fmt.Sprintf("id-%d", i+1))
+	}
+	c.Assert(srv.published(), qt.DeepEquals, [][]string{{"1", "3"}})
+}
+
+func TestPublisher_Ordering(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// The server reports each batch and waits to be told which status to respond with
+	arrived := make(chan []string)
+	respond := make(chan int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		params := &types.PublishBatchParams{}
+		c.Check(json.NewDecoder(req.Body).Decode(params), qt.IsNil)
+		var batch []string
+		resp := &types.PublishBatchResponse{}
+		for _, msg := range params.Messages {
+			batch = append(batch, msg.OrderingKey+string(msg.Payload))
+			resp.Results = append(resp.Results, &types.PublishBatchResult{MessageID: "id-" + string(msg.Payload)})
+		}
+		arrived <- batch
+		if status := <-respond; status != http.StatusOK {
+			http.Error(w, `{"code": "invalid_argument", "message": "rejected"}`, status)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+
+	p := newTestClient(srv.URL, func(cfg *client.Config) { cfg.Retry = client.RetryPolicy{MaxAttempts: 1} }).
+		NewPublisher("my-topic", PublisherConfig{CountThreshold: 1, EnableMessageOrdering: true})
+	publish := func(key, data string) *PublishResult {
+		return p.Publish(ctx, Message{OrderingKey: key, Data: []byte(data)})
+	}
+
+	// Messages for a key wait for the batch before them to be sent
+	r1 := publish("a", "1")
+	c.Assert(<-arrived, qt.DeepEquals, []string{"a1"})
+	r2, r3 := publish("a", "2"), publish("a", "3")
+	respond <- http.StatusOK
+	c.Assert(<-arrived, qt.DeepEquals, []string{"a2", "a3"})
+	msgID, err := r1.Get(ctx)
+	c.Assert(err, qt.IsNil)
+	c.Assert(msgID, qt.Equals, "id-1")
+
+	// When a batch fails, the key is paused and the messages after it fail
+	r4 := publish("a", "4")
+	respond <- http.StatusBadRequest
+	for _, result := range []*PublishResult{r2, r3} {
+		_, err := result.Get(ctx)
+		var apiErr *APIError
+		c.Assert(errors.As(err, &apiErr), qt.IsTrue)
+	}
+	_, err = r4.Get(ctx)
+	c.Assert(err, qt.ErrorIs, ErrOrderingKeyPaused)
+	c.Assert(err, qt.ErrorMatches, `ordering key paused: "a" after an earlier message failed to publish: .*rejected.*`)
+	_, err = publish("a", "5").Get(ctx)
+	c.Assert(err, qt.ErrorIs, ErrOrderingKeyPaused)
+
+	// Other keys, and messages without a key, are unaffected
+	r6, r7 := publish("b", "6"), publish("", "7")
+	got := [][]string{<-arrived, <-arrived}
+	sort.Slice(got, func(i, j int) bool { return got[i][0] > got[j][0] })
+	c.Assert(got, qt.DeepEquals, [][]string{{"b6"}, {"7"}})
+	respond <- http.StatusOK
+	respond <- http.StatusOK
+	for _, result := range []*PublishResult{r6, r7} {
+		_, err := result.Get(ctx)
+		c.Assert(err, qt.IsNil)
+	}
+
+	// Once resumed, the key can be published to again
+	p.ResumePublish("a")
+	r8 := publish("a", "8")
+	c.Assert(<-arrived, qt.DeepEquals, []string{"a8"})
+	respond <- http.StatusOK
+	msgID, err = r8.Get(ctx)
+	c.Assert(err, qt.IsNil)
+	c.Assert(msgID, qt.Equals, "id-8")
+	c.Assert(p.Stop(ctx), qt.IsNil)
+}
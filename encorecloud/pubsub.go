@@ -2,18 +2,27 @@ package encorecloud
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/rs/zerolog"
 	"go.encore.dev/platform-sdk/encorecloud/types"
+	"go.encore.dev/platform-sdk/internal/client"
 	"go.encore.dev/platform-sdk/internal/jsonerr"
 	"go.encore.dev/platform-sdk/pkg/auth"
+	"go.encore.dev/platform-sdk/pkg/logging"
+	"go.encore.dev/platform-sdk/pkg/metrics"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -31,29 +40,175 @@ const (
 //
 // It returns the message ID of the published message from the underlying message broker and
 // any error encountered.
-func (c *Client) PublishToTopic(ctx context.Context, topicID string, orderingKey string, attrs map[string]string, data []byte) (msgID string, err error) {
+//
+// If tracing is enabled, the trace context is propagated to subscribers using the
+// traceparent and tracestate attributes.
+//
+// Options such as [DeliverAfter] can be given to control how the message is published.
+// The message is validated before it is sent, so for instance a deduplication ID longer
+// than [types.MaxDeduplicationIDLength] is rejected without a request being made.
+func (c *Client) PublishToTopic(ctx context.Context, topicID string, orderingKey string, attrs map[string]string, data []byte, options ...PublishOption) (msgID string, err error) {
+	opts := newPublishOptions(options)
 	params := &types.PublishParams{
-		OrderingKey: orderingKey,
-		Attributes:  attrs,
-		Payload:     data,
+		OrderingKey:     orderingKey,
+		Payload:         data,
+		DeduplicationID: opts.deduplicationIDFor(attrs, data),
 	}
-	resp := &types.PublishResponse{}
+	opts.apply(params)
 
-	err = c.client.SignedPost(
-		ctx,
-		fmt.Sprintf("/v1/pubsub/%s/publish", url.PathEscape(topicID)),
-		auth.PubsubMsg, auth.Create,
-		params, resp,
+	// An invalid message is rejected before anything is traced or measured, as it is never sent
+	if err := params.Validate(); err != nil {
+		return "", fmt.Errorf("invalid message: %w", err)
+	}
 
-		[]byte(topicID),
-	)
+	ctx, span, attrs := c.startPublishSpan(ctx, topicID, attrs)
+	defer func() { endSpan(span, err) }()
+	params.Attributes = attrs
+
+	start := c.client.Clock().Now()
+	defer func() {
+		c.client.Metrics().ObservePublish(topicID, client.OutcomeOf(err), c.client.Clock().Since(start))
+	}()
+
+	resp := &types.PublishResponse{}
+
+	err = c.client.Do(ctx, client.SignedRequest{
+		Method:                http.MethodPost,
+		Path:                  fmt.Sprintf("/v1/pubsub/%s/publish", url.PathEscape(topicID)),
+		PathTemplate:          "/v1/pubsub/{topic}/publish",
+		Object:                auth.PubsubMsg,
+		Action:                auth.Create,
+		AdditionalAuthContext: [][]byte{[]byte(topicID)},
+		Payload:               params,
+		Response:              resp,
+	})
 	if err != nil {
 		return "", fmt.Errorf("unable to sign publish request: %w", err)
 	}
 
+	span.SetAttributes(attribute.String("messaging.message.id", resp.MessageID))
+	if opts.duplicate != nil {
+		*opts.duplicate = resp.Duplicate
+	}
 	return resp.MessageID, nil
 }
 
+// PublishOption configures how a message is published.
+type PublishOption func(*publishOptions)
+
+type publishOptions struct {
+	deliverAt            time.Time
+	deliverAfter         time.Duration
+	deduplicationID      string
+	contentDeduplication bool
+	duplicate            *bool
+}
+
+func newPublishOptions(options []PublishOption) *publishOptions {
+	opts := &publishOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+	return opts
+}
+
+// apply sets the options on the publish parameters.
+func (o *publishOptions) apply(params *types.PublishParams) {
+	if !o.deliverAt.IsZero() {
+		deliverAt := o.deliverAt.UTC()
+		params.DeliverAt = &deliverAt
+	}
+	if o.deliverAfter != 0 {
+		params.DeliverAfterMillis = o.deliverAfter.Milliseconds()
+		if params.DeliverAfterMillis == 0 && o.deliverAfter > 0 {
+			params.DeliverAfterMillis = 1
+		}
+	}
+}
+
+// deduplicationIDFor returns the deduplication ID to publish the message with,
+// given the attributes and data it was published with by the caller.
+func (o *publishOptions) deduplicationIDFor(attrs map[string]string, data []byte) string {
+	if o.contentDeduplication {
+		return ContentDeduplicationID(attrs, data)
+	}
+	return o.deduplicationID
+}
+
+// DeliverAt delays delivering the message to subscriptions until the given time.
+// Messages with the same ordering key are still delivered in order, so a delayed
+// message also delays the messages published after it with the same key.
+func DeliverAt(t time.Time) PublishOption {
+	return func(o *publishOptions) {
+		o.deliverAt, o.deliverAfter = t, 0
+	}
+}
+
+// DeliverAfter delays delivering the message to subscriptions until the given duration
+// after it is published, see [DeliverAt]. The delay is measured by Encore Cloud, so it
+// isn't affected by any skew between the local clock and Encore Cloud's.
+//
+// The duration must not be negative, and is rounded to milliseconds.
+func DeliverAfter(d time.Duration) PublishOption {
+	return func(o *publishOptions) {
+		o.deliverAt, o.deliverAfter = time.Time{}, d
+	}
+}
+
+// WithDeduplicationID publishes the message with the given deduplication ID, such that if a message
+// with the same ID has already been published to the topic within the platform's deduplication window,
+// the message isn't published again and the ID of the original message is returned instead. This makes
+// it safe to retry publishing a message after a timeout, as long as the same ID is used.
+//
+// The ID must be at most [types.MaxDeduplicationIDLength] characters.
+func WithDeduplicationID(id string) PublishOption {
+	return func(o *publishOptions) {
+		o.deduplicationID, o.contentDeduplication = id, false
+	}
+}
+
+// WithContentDeduplication publishes the message with a deduplication ID derived from its
+// attributes and data (see [ContentDeduplicationID]), such that publishing the same message
+// twice within the deduplication window only publishes it once. See [WithDeduplicationID].
+func WithContentDeduplication() PublishOption {
+	return func(o *publishOptions) {
+		o.deduplicationID, o.contentDeduplication = "", true
+	}
+}
+
+// ReportDuplicate sets *duplicate to whether the message was a duplicate of one already
+// published with the same deduplication ID, once the message has been published.
+func ReportDuplicate(duplicate *bool) PublishOption {
+	return func(o *publishOptions) {
+		o.duplicate = duplicate
+	}
+}
+
+// ContentDeduplicationID returns a deduplication ID derived from the attributes and data of a
+// message, as used by [WithContentDeduplication].
+//
+// Attributes added by the SDK itself, such as the trace context, are not part of the ID.
+func ContentDeduplicationID(attrs map[string]string, data []byte) string {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// Length prefix every field so that different messages can't produce the same input
+	h := sha256.New()
+	writeField := func(b []byte) {
+		_ = binary.Write(h, binary.BigEndian, uint64(len(b)))
+		_, _ = h.Write(b)
+	}
+	for _, k := range keys {
+		writeField([]byte(k))
+		writeField([]byte(attrs[k]))
+	}
+	writeField(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 // CreateSubscriptionHandler returns a [http.HandlerFunc] that can be used to handle
 // subscription push requests from EncoreCloud.
 //
@@ -63,11 +218,22 @@ func (c *Client) PublishToTopic(ctx context.Context, topicID string, orderingKey
 // with older running applications without requiring them to be updated and redeployed.
 //
 // The handler will a 406 Not Acceptable error server cannot accept the request due to a newer push version.
-func (c *Client) CreateSubscriptionHandler(subscriptionID string, logger *zerolog.Logger, callback types.SubscriptionCallback) http.HandlerFunc {
+//
+// From push version 3, Encore Cloud pushes messages in batches, which the handler processes concurrently,
+// calling the callback for at most [DefaultMaxConcurrency] messages at a time unless configured otherwise
+// with [WithMaxConcurrency].
+//
+// The handler logs to the given zerolog logger, or if it is nil, to the logger the SDK is configured with.
+func (c *Client) CreateSubscriptionHandler(subscriptionID string, zlogger *zerolog.Logger, callback types.SubscriptionCallback, options ...SubscriptionOption) http.HandlerFunc {
+	logger := c.client.Logger()
+	if zlogger != nil {
+		logger = logging.Zerolog(zlogger)
+	}
+	opts := newSubscriptionOptions(options)
+
 	return func(w http.ResponseWriter, req *http.Request) {
-		// Check the requested version is supported by this handler
-		// (for now only version 1 is supported, but this code allows "version 1, 2, 3" to be requested)
-		// and will allow this handler to respond with a version 1 response
+		// Check the requested version is supported by this handler, responding with
+		// the highest version requested which it supports (currently 1, 2 or 3)
 		requestedVersions := make(map[string]struct{})
 		for _, acceptStr := range req.Header.Values(PushVersionAcceptHeader) {
 			for _, version := range strings.Split(acceptStr, ",") {
@@ -75,8 +241,16 @@ func (c *Client) CreateSubscriptionHandler(subscriptionID string, logger *zerolo
 			}
 		}
 
+		if _, ok := requestedVersions["3"]; ok {
+			subscriptionHandlerV3(w, req, c, subscriptionID, logger, callback, opts)
+			return
+		}
+		if _, ok := requestedVersions["2"]; ok {
+			subscriptionHandler(w, req, c, subscriptionID, logger, callback, 2)
+			return
+		}
 		if _, ok := requestedVersions["1"]; ok {
-			subscriptionHandlerV1(w, req, c, subscriptionID, logger, callback)
+			subscriptionHandler(w, req, c, subscriptionID, logger, callback, 1)
 			return
 		}
 
@@ -88,7 +262,7 @@ func (c *Client) CreateSubscriptionHandler(subscriptionID string, logger *zerolo
 		sort.Strings(versionsStr)
 
 		err := fmt.Errorf("requested versions: %s", strings.Join(versionsStr, ", "))
-		logger.Err(err).Msg("PubSub push endpoint received request with versions it cannot accept")
+		logger.Error("PubSub push endpoint received request with versions it cannot accept", "subscription", subscriptionID, "error", err)
 		jsonerr.Error(w, err, http.StatusNotAcceptable)
 	}
 }
@@ -96,6 +270,9 @@ func (c *Client) CreateSubscriptionHandler(subscriptionID string, logger *zerolo
 // Encore Cloud will send a POST request to the endpoint with a JSON encoded [pushPayload] as the body.
 // The request will be signed with the latest Encore Cloud auth key for this application.
 //
+// The body may be compressed using any of the encodings advertised by the handler in the Accept-Encoding
+// response header, in which case the signature is still computed over the uncompressed body.
+//
 // Once the request is received and verified, the user's subscription function will be called with the decoded
 // payload, while simultaneously an event stream will be sent back to Encore Cloud to indicate that the request
 // is being processed, with keepalive messages being sent every 5 seconds.
@@ -116,7 +293,12 @@ func (c *Client) CreateSubscriptionHandler(subscriptionID string, logger *zerolo
 // - "keepalive" - A message to inform the server that the client is still processing.
 // - "ack" - A message to confirm the client has successfully processed the message.
 // - "nack" - A message to tell the server the client failed to process the message and it should be retried.
-func subscriptionHandlerV1(w http.ResponseWriter, req *http.Request, c *Client, subscriptionID string, logger *zerolog.Logger, callback types.SubscriptionCallback) {
+//
+// In version 1, the data of a nack event is the error message. From version 2, it is a JSON encoded
+// [types.SubscriptionNack], which also tells the server when to retry the message if the subscription
+// function returned an error wrapped with [RetryAfter], or not to retry it at all if it was wrapped
+// with [Permanent].
+func subscriptionHandler(w http.ResponseWriter, req *http.Request, c *Client, subscriptionID string, logger logging.Logger, callback types.SubscriptionCallback, version int) {
 	// Decode the request
 	payload := &types.SubscriptionPushParams{}
 	err := c.client.VerifyAndDecodeRequest(
@@ -125,23 +307,37 @@ func subscriptionHandlerV1(w http.ResponseWriter, req *http.Request, c *Client,
 		payload,
 		[]byte(subscriptionID),
 	)
-	if err != nil {
-		logger.Err(err).Msg("error while verifying PubSub subscription message")
+	if errors.Is(err, client.ErrUnsupportedEncoding) {
+		logger.Error("PubSub push endpoint received a request with an unsupported content encoding", "subscription", subscriptionID, "error", err)
+		w.Header().Set("Accept-Encoding", client.AcceptedEncodings)
+		jsonerr.Error(w, err, http.StatusUnsupportedMediaType)
+		return
+	} else if errors.Is(err, client.ErrRequestBodyTooLarge) {
+		logger.Error("PubSub push endpoint received a request which is too large", "subscription", subscriptionID, "error", err)
+		jsonerr.Error(w, err, http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		logger.Error("error while verifying PubSub subscription message", "subscription", subscriptionID, "error", err)
 		jsonerr.Error(w, err, http.StatusUnauthorized)
 		return
 	}
 
+	// Trace the processing of the message
+	ctx, span := c.startProcessSpan(req.Context(), subscriptionID, payload)
+
 	// Ensure we can flush the responses
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		err = errors.New("unable to cast http.ResponseWriter to http.Flusher")
-		logger.Err(err).Msg("error while setting up flushing response")
+		endSpan(span, err)
+		logger.Error("error while setting up flushing response", "subscription", subscriptionID, "error", err)
 		jsonerr.Error(w, err, http.StatusInternalServerError)
 		return
 	}
 
-	// Start the event stream
-	w.Header().Set(PushVersionHeader, "1")
+	// Start the event stream, advertising the encodings we accept for future push requests
+	w.Header().Set(PushVersionHeader, strconv.Itoa(version))
+	w.Header().Set("Accept-Encoding", client.AcceptedEncodings)
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
@@ -149,18 +345,19 @@ func subscriptionHandlerV1(w http.ResponseWriter, req *http.Request, c *Client,
 	flusher.Flush()
 
 	// Run the subscription function in a goroutine
+	start := c.client.Clock().Now()
+	lag := start.Sub(payload.PublishTime)
 	response := make(chan error, 1)
 	go func() {
 		defer func() {
 			if r := recover(); r != nil {
-				err = fmt.Errorf("panic while processing PubSub message: %v", r)
-				response <- err
+				response <- fmt.Errorf("panic while processing PubSub message: %v", r)
 			}
 			close(response)
 		}()
 
 		response <- callback(
-			req.Context(),
+			ctx,
 			payload.MessageID, payload.PublishTime, payload.DeliveryAttempt,
 			payload.Attributes, payload.Data,
 		)
@@ -175,18 +372,20 @@ func subscriptionHandlerV1(w http.ResponseWriter, req *http.Request, c *Client,
 	for !finished {
 		select {
 		case <-req.Context().Done():
-			logger.Err(err).Msg("PubSub push endpoint closed by Encore Cloud before subscription function completed")
+			logger.Error("PubSub push endpoint closed by Encore Cloud before subscription function completed", "subscription", subscriptionID, "message_id", payload.MessageID, "error", req.Context().Err())
+			endSpan(span, req.Context().Err())
+			c.client.Metrics().ObservePush(subscriptionID, metrics.Cancelled, c.client.Clock().Since(start), payload.DeliveryAttempt, lag)
 			return
 
 		case <-keepAliveTimeout.C:
 			// Send a keepalive message
 			if _, err := fmt.Fprintf(w, "event: keepalive\ndata: \n\n"); err != nil {
-				logger.Err(err).Msg("error while sending keepalive message")
+				logger.Error("error while sending keepalive message", "subscription", subscriptionID, "error", err)
 			}
 			flusher.Flush()
 
-		case err, done := <-response:
-			if done {
+		case err, ok := <-response:
+			if !ok {
 				finished = true
 			} else if firstError == nil {
 				firstError = err
@@ -195,15 +394,27 @@ func subscriptionHandlerV1(w http.ResponseWriter, req *http.Request, c *Client,
 	}
 
 	// Now that the subscription function has completed, send the end message
+	endSpan(span, firstError)
+	outcome := metrics.Ack
 	if firstError != nil {
-		logger.Err(firstError).Msg("error while handling PubSub subscription message")
+		outcome = metrics.Nack
+	}
+	c.client.Metrics().ObservePush(subscriptionID, outcome, c.client.Clock().Since(start), payload.DeliveryAttempt, lag)
+
+	if firstError != nil {
+		logger.Error("error while handling PubSub subscription message", "subscription", subscriptionID, "message_id", payload.MessageID, "error", firstError)
 
-		if _, err := fmt.Fprintf(w, "event: nack\ndata: %s\n\n", firstError.Error()); err != nil {
-			logger.Err(err).Msg("error while sending nack message")
+		data := firstError.Error()
+		if version >= 2 {
+			nack, _ := json.Marshal(nackFor(firstError))
+			data = string(nack)
+		}
+		if _, err := fmt.Fprintf(w, "event: nack\ndata: %s\n\n", data); err != nil {
+			logger.Error("error while sending nack message", "subscription", subscriptionID, "error", err)
 		}
 	} else {
 		if _, err := fmt.Fprintf(w, "event: ack\ndata: \n\n"); err != nil {
-			logger.Err(err).Msg("error while sending ack message")
+			logger.Error("error while sending ack message", "subscription", subscriptionID, "error", err)
 		}
 	}
 	flusher.Flush()
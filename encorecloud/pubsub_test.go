@@ -0,0 +1,570 @@
+package encorecloud
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	qt "github.com/frankban/quicktest"
+	"github.com/rs/zerolog"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"go.encore.dev/platform-sdk/encorecloud/types"
+	"go.encore.dev/platform-sdk/internal/client"
+	"go.encore.dev/platform-sdk/pkg/auth"
+	"go.encore.dev/platform-sdk/pkg/metrics"
+)
+
+var testKey = auth.Key{KeyID: 1, Data: []byte("test-key-data")} // nolint: gochecknoglobals
+
+func newTestClient(host string, configure ...func(cfg *client.Config)) *Client {
+	cfg := &client.Config{
+		Host:          host,
+		Clock:         clock.New(),
+		AppSlug:       "test-app",
+		EnvName:       "test-env",
+		LatestAuthKey: testKey,
+		AuthKeys:      []auth.Key{testKey},
+	}
+	for _, fn := range configure {
+		fn(cfg)
+	}
+	return NewClient(client.New(cfg))
+}
+
+// newPushRequest creates a signed push request for the given subscription as Encore Cloud would send it.
+// newPushRequest returns a signed push request, with either a single message for push version 1
+// or a batch of messages for push version 2.
+func newPushRequest(c *qt.C, subscriptionID string, msg auth.Payload) *http.Request {
+	opHash, err := auth.NewOperationHash(auth.PubsubMsg, auth.Read, msg, []byte(subscriptionID))
+	c.Assert(err, qt.IsNil)
+	headers := auth.Sign(&testKey, "test-app", "test-env", clock.New(), opHash)
+
+	body, err := json.Marshal(msg)
+	c.Assert(err, qt.IsNil)
+
+	req := httptest.NewRequest(http.MethodPost, "/push", bytes.NewReader(body))
+	req.Header.Set("Authorization", headers.Authorization)
+	req.Header.Set("Date", headers.Date)
+	req.Header.Set(PushVersionAcceptHeader, "1")
+	return req
+}
+
+func TestTracePropagation(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	withTracing := func(cfg *client.Config) { cfg.TracerProvider = tp }
+
+	// Publish a message, capturing what the platform receives
+	var published types.PublishParams
+	var publishHeaders http.Header
+	platform := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		publishHeaders = req.Header.Clone()
+		c.Check(json.NewDecoder(req.Body).Decode(&published), qt.IsNil)
+		_ = json.NewEncoder(w).Encode(&types.PublishResponse{MessageID: "msg-1"})
+	}))
+	defer platform.Close()
+
+	cl := newTestClient(platform.URL, withTracing)
+	attrs := map[string]string{"foo": "bar"}
+	msgID, err := cl.PublishToTopic(context.Background(), "my-topic", "", attrs, []byte(`{"hello":"world"}`))
+	c.Assert(err, qt.IsNil)
+	c.Assert(msgID, qt.Equals, "msg-1")
+	c.Assert(attrs, qt.DeepEquals, map[string]string{"foo": "bar"}, qt.Commentf("caller's attributes should not be modified"))
+	c.Assert(published.Attributes["foo"], qt.Equals, "bar")
+	c.Assert(published.Attributes["traceparent"], qt.Not(qt.Equals), "")
+	c.Assert(publishHeaders.Get("traceparent"), qt.Not(qt.Equals), "")
+
+	// Push the message to the subscription handler
+	var callbackSpan trace.SpanContext
+	handler := cl.CreateSubscriptionHandler("my-sub", &zerolog.Logger{}, func(ctx context.Context, msgID string, publishTime time.Time, deliveryAttempt int, attrs map[string]string, data []byte) error {
+		callbackSpan = trace.SpanContextFromContext(ctx)
+		return nil
+	})
+	rec := httptest.NewRecorder()
+	handler(rec, newPushRequest(c, "my-sub", &types.SubscriptionPushParams{
+		Data:            published.Payload,
+		Attributes:      published.Attributes,
+		MessageID:       msgID,
+		PublishTime:     time.Now(),
+		DeliveryAttempt: 1,
+	}))
+	c.Assert(rec.Body.String(), qt.Contains, "event: ack")
+
+	// Check the spans are all part of the same trace
+	spans := exporter.GetSpans()
+	byName := make(map[string]tracetest.SpanStub)
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+	c.Assert(byName, qt.HasLen, 3)
+
+	publish := byName["my-topic publish"]
+	request := byName["create pubsub-msg"]
+	process := byName["my-sub process"]
+	c.Assert(publish.SpanKind, qt.Equals, trace.SpanKindProducer)
+	c.Assert(request.SpanKind, qt.Equals, trace.SpanKindClient)
+	c.Assert(process.SpanKind, qt.Equals, trace.SpanKindConsumer)
+
+	c.Assert(request.Parent.SpanID(), qt.Equals, publish.SpanContext.SpanID())
+	c.Assert(process.Parent.SpanID(), qt.Equals, publish.SpanContext.SpanID())
+	c.Assert(process.Parent.IsRemote(), qt.IsTrue)
+	c.Assert(process.SpanContext.TraceID(), qt.Equals, publish.SpanContext.TraceID())
+	c.Assert(callbackSpan.SpanID(), qt.Equals, process.SpanContext.SpanID())
+}
+
+// recordingMetrics records the observations made by the SDK.
+type recordingMetrics struct {
+	mu           sync.Mutex
+	requests     []string
+	publishes    []string
+	pushes       []string
+	pushAttempts []int
+	pushLags     []time.Duration
+}
+
+func (m *recordingMetrics) ObserveRequest(object, action string, outcome metrics.Outcome, _ time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = append(m.requests, object+" "+action+" "+string(outcome))
+}
+
+func (m *recordingMetrics) ObservePublish(topic string, outcome metrics.Outcome, _ time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.publishes = append(m.publishes, topic+" "+string(outcome))
+}
+
+func (m *recordingMetrics) ObservePush(subscription string, outcome metrics.Outcome, _ time.Duration, deliveryAttempt int, lag time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pushes = append(m.pushes, subscription+" "+string(outcome))
+	m.pushAttempts = append(m.pushAttempts, deliveryAttempt)
+	m.pushLags = append(m.pushLags, lag)
+}
+
+func TestPublishOptions(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name            string
+		options         []PublishOption
+		want            *time.Time
+		wantAfterMillis int64
+	}{
+		{name: "none"},
+		{
+			name:    "deliver at",
+			options: []PublishOption{DeliverAt(now.Add(time.Hour).In(time.FixedZone("CEST", 2*60*60)))},
+			want:    ptr(now.Add(time.Hour)),
+		},
+		{
+			name:            "deliver after",
+			options:         []PublishOption{DeliverAfter(15 * time.Minute)},
+			wantAfterMillis: 15 * 60 * 1000,
+		},
+		{
+			name:            "deliver after less than a millisecond",
+			options:         []PublishOption{DeliverAfter(time.Microsecond)},
+			wantAfterMillis: 1,
+		},
+		{
+			name:    "last option wins",
+			options: []PublishOption{DeliverAfter(15 * time.Minute), DeliverAt(now.Add(time.Hour))},
+			want:    ptr(now.Add(time.Hour)),
+		},
+		{
+			name:            "last option wins the other way around",
+			options:         []PublishOption{DeliverAt(now.Add(time.Hour)), DeliverAfter(15 * time.Minute)},
+			wantAfterMillis: 15 * 60 * 1000,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := qt.New(t)
+
+			mockClock := clock.NewMock()
+			mockClock.Set(now)
+
+			var published types.PublishParams
+			platform := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				opHash, err := auth.GetVerifiedOperationHash(req, []auth.Key{testKey}, mockClock)
+				c.Check(err, qt.IsNil)
+				c.Check(json.NewDecoder(req.Body).Decode(&published), qt.IsNil)
+				valid, err := opHash.Verify(auth.PubsubMsg, auth.Create, &published, []byte("my-topic"))
+				c.Check(err, qt.IsNil)
+				c.Check(valid, qt.IsTrue, qt.Commentf("the delivery time should be signed"))
+				_ = json.NewEncoder(w).Encode(&types.PublishResponse{MessageID: "msg-1"})
+			}))
+			defer platform.Close()
+
+			cl := newTestClient(platform.URL, func(cfg *client.Config) { cfg.Clock = mockClock })
+			_, err := cl.PublishToTopic(context.Background(), "my-topic", "", nil, []byte(`{}`), tt.options...)
+			c.Assert(err, qt.IsNil)
+			c.Assert(published.DeliverAt, qt.DeepEquals, tt.want)
+			c.Assert(published.DeliverAfterMillis, qt.Equals, tt.wantAfterMillis)
+		})
+	}
+}
+
+func TestDeduplication(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	// The platform reports messages as duplicates when it has already seen their ID
+	seen := make(map[string]string)
+	var mu sync.Mutex
+	platform := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var params types.PublishParams
+		c.Check(json.NewDecoder(req.Body).Decode(&params), qt.IsNil)
+		mu.Lock()
+		defer mu.Unlock()
+		if msgID, found := seen[params.DeduplicationID]; found {
+			_ = json.NewEncoder(w).Encode(&types.PublishResponse{MessageID: msgID, Duplicate: true})
+			return
+		}
+		msgID := fmt.Sprintf("msg-%d", len(seen)+1)
+		seen[params.DeduplicationID] = msgID
+		_ = json.NewEncoder(w).Encode(&types.PublishResponse{MessageID: msgID})
+	}))
+	defer platform.Close()
+	cl := newTestClient(platform.URL, func(cfg *client.Config) { cfg.TracerProvider = tp })
+
+	publish := func(data string, options ...PublishOption) (string, bool) {
+		var duplicate bool
+		msgID, err := cl.PublishToTopic(context.Background(), "my-topic", "", map[string]string{"k": "v"}, []byte(data),
+			append(options, ReportDuplicate(&duplicate))...)
+		c.Assert(err, qt.IsNil)
+		return msgID, duplicate
+	}
+
+	msgID, duplicate := publish(`1`, WithDeduplicationID("order-1"))
+	c.Assert(msgID, qt.Equals, "msg-1")
+	c.Assert(duplicate, qt.IsFalse)
+	msgID, duplicate = publish(`2`, WithDeduplicationID("order-1"))
+	c.Assert(msgID, qt.Equals, "msg-1")
+	c.Assert(duplicate, qt.IsTrue)
+
+	// Content based IDs ignore the trace context, which differs between publishes
+	msgID, duplicate = publish(`3`, WithContentDeduplication())
+	c.Assert(msgID, qt.Equals, "msg-2")
+	c.Assert(duplicate, qt.IsFalse)
+	msgID, duplicate = publish(`3`, WithContentDeduplication())
+	c.Assert(msgID, qt.Equals, "msg-2")
+	c.Assert(duplicate, qt.IsTrue)
+	c.Assert(seen[ContentDeduplicationID(map[string]string{"k": "v"}, []byte(`3`))], qt.Equals, "msg-2")
+}
+
+func TestPublish_InvalidMessage(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	var requests atomic.Int32
+	platform := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+	}))
+	defer platform.Close()
+	m := &recordingMetrics{}
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	cl := newTestClient(platform.URL, func(cfg *client.Config) {
+		cfg.Metrics = m
+		cfg.TracerProvider = tp
+	})
+	ctx := context.Background()
+	tooLong := strings.Repeat("a", types.MaxDeduplicationIDLength+1)
+
+	// Invalid messages are rejected without being sent
+	_, err := cl.PublishToTopic(ctx, "my-topic", "", nil, []byte(`{}`), WithDeduplicationID(tooLong))
+	c.Assert(err, qt.ErrorMatches, "invalid message: deduplication ID must be at most 128 characters")
+	_, err = cl.PublishToTopic(ctx, "my-topic", "", nil, []byte(`{}`), DeliverAfter(-time.Minute))
+	c.Assert(err, qt.ErrorMatches, "invalid message: deliver after must not be negative")
+
+	results, err := cl.PublishBatch(ctx, "my-topic", []Message{
+		{Data: []byte(`{}`)},
+		{Data: []byte(`{}`), DeduplicationID: tooLong},
+	})
+	c.Assert(err, qt.ErrorMatches, "invalid message 1: deduplication ID must be at most 128 characters")
+	c.Assert(results, qt.IsNil)
+
+	c.Assert(requests.Load(), qt.Equals, int32(0), qt.Commentf("nothing should be sent"))
+
+	// Nor are they recorded as failed publishes
+	c.Assert(m.publishes, qt.HasLen, 0)
+	c.Assert(exporter.GetSpans(), qt.HasLen, 0)
+}
+
+func TestContentDeduplicationID(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	id := ContentDeduplicationID(map[string]string{"a": "1", "b": "2"}, []byte(`{}`))
+	c.Assert(id, qt.HasLen, 64)
+	c.Assert(ContentDeduplicationID(map[string]string{"b": "2", "a": "1"}, []byte(`{}`)), qt.Equals, id)
+
+	for _, other := range []string{
+		ContentDeduplicationID(map[string]string{"a": "1", "b": "2"}, []byte(`[]`)),
+		ContentDeduplicationID(map[string]string{"a": "12"}, []byte(`{}`)),
+		ContentDeduplicationID(map[string]string{"a": "1", "b": "2", "c": ""}, []byte(`{}`)),
+		ContentDeduplicationID(nil, []byte(`{}`)),
+	} {
+		c.Assert(other, qt.Not(qt.Equals), id)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	platform := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/v1/pubsub/missing/publish" {
+			http.Error(w, `{"code": "not_found", "message": "topic not found"}`, http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(&types.PublishResponse{MessageID: "msg-1"})
+	}))
+	defer platform.Close()
+
+	m := &recordingMetrics{}
+	cl := newTestClient(platform.URL, func(cfg *client.Config) { cfg.Metrics = m })
+
+	_, err := cl.PublishToTopic(context.Background(), "my-topic", "", nil, []byte(`{}`))
+	c.Assert(err, qt.IsNil)
+	_, err = cl.PublishToTopic(context.Background(), "missing", "", nil, []byte(`{}`))
+	c.Assert(err, qt.ErrorMatches, ".*topic not found")
+
+	handler := cl.CreateSubscriptionHandler("my-sub", &zerolog.Logger{}, func(ctx context.Context, msgID string, publishTime time.Time, deliveryAttempt int, attrs map[string]string, data []byte) error {
+		return errors.New("failed")
+	})
+	handler(httptest.NewRecorder(), newPushRequest(c, "my-sub", &types.SubscriptionPushParams{
+		Data:            []byte(`{}`),
+		MessageID:       "msg-1",
+		PublishTime:     time.Now().Add(-time.Minute),
+		DeliveryAttempt: 3,
+	}))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c.Assert(m.requests, qt.DeepEquals, []string{"pubsub-msg create success", "pubsub-msg create client_error"})
+	c.Assert(m.publishes, qt.DeepEquals, []string{"my-topic success", "missing client_error"})
+	c.Assert(m.pushes, qt.DeepEquals, []string{"my-sub nack"})
+	c.Assert(m.pushAttempts, qt.DeepEquals, []int{3})
+	c.Assert(m.pushLags[0] >= time.Minute, qt.IsTrue, qt.Commentf("lag %s should be at least a minute", m.pushLags[0]))
+}
+
+func TestNackEvents(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		acceptVer   string
+		err         error
+		wantVersion string
+		wantData    string
+	}{
+		{
+			name:        "v1",
+			acceptVer:   "1",
+			err:         RetryAfter(time.Minute, errors.New("busy")),
+			wantVersion: "1",
+			wantData:    "busy",
+		},
+		{
+			name:        "v2 plain error",
+			acceptVer:   "1, 2",
+			err:         errors.New("failed"),
+			wantVersion: "2",
+			wantData:    `{"error":"failed"}`,
+		},
+		{
+			name:        "v2 retry after",
+			acceptVer:   "1, 2",
+			err:         RetryAfter(1500*time.Millisecond, errors.New("busy")),
+			wantVersion: "2",
+			wantData:    `{"error":"busy","retry_after_ms":1500}`,
+		},
+		{
+			name:        "v2 permanent",
+			acceptVer:   "2",
+			err:         fmt.Errorf("handling order: %w", Permanent(errors.New("invalid order"))),
+			wantVersion: "2",
+			wantData:    `{"error":"handling order: invalid order","permanent":true}`,
+		},
+		{
+			name:        "v3 batch",
+			acceptVer:   "1, 2, 3",
+			err:         RetryAfter(1500*time.Millisecond, errors.New("busy")),
+			wantVersion: "3",
+			wantData:    `{"message_id":"msg-1","error":"busy","retry_after_ms":1500}`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := qt.New(t)
+
+			cl := newTestClient("http://localhost")
+			handler := cl.CreateSubscriptionHandler("my-sub", nil, func(ctx context.Context, msgID string, publishTime time.Time, deliveryAttempt int, attrs map[string]string, data []byte) error {
+				return tt.err
+			})
+			var payload auth.Payload = &types.SubscriptionPushParams{Data: []byte(`{}`), MessageID: "msg-1", DeliveryAttempt: 1}
+			if tt.wantVersion == "3" {
+				payload = &types.SubscriptionPushBatchParams{Messages: []*types.SubscriptionPushParams{payload.(*types.SubscriptionPushParams)}}
+			}
+			req := newPushRequest(c, "my-sub", payload)
+			req.Header.Set(PushVersionAcceptHeader, tt.acceptVer)
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			c.Assert(rec.Header().Get(PushVersionHeader), qt.Equals, tt.wantVersion)
+			c.Assert(rec.Body.String(), qt.Equals, "event: nack\ndata: "+tt.wantData+"\n\n")
+		})
+	}
+}
+
+func TestBatchPush(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	m := &recordingMetrics{}
+	cl := newTestClient("http://localhost", func(cfg *client.Config) { cfg.Metrics = m })
+
+	// Block the callbacks until as many are running as the concurrency allows
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	release := make(chan struct{})
+	var releaseOnce sync.Once
+	handler := cl.CreateSubscriptionHandler("my-sub", &zerolog.Logger{}, func(ctx context.Context, msgID string, publishTime time.Time, deliveryAttempt int, attrs map[string]string, data []byte) error {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		if running == 2 {
+			releaseOnce.Do(func() { close(release) })
+		}
+		mu.Unlock()
+
+		<-release
+		mu.Lock()
+		running--
+		mu.Unlock()
+		if msgID == "msg-3" {
+			return RetryAfter(time.Second, errors.New("busy"))
+		}
+		return nil
+	}, WithMaxConcurrency(2))
+
+	batch := &types.SubscriptionPushBatchParams{}
+	for i := 1; i <= 5; i++ {
+		batch.Messages = append(batch.Messages, &types.SubscriptionPushParams{
+			Data:            []byte(`{}`),
+			MessageID:       fmt.Sprintf("msg-%d", i),
+			PublishTime:     time.Now(),
+			DeliveryAttempt: 1,
+		})
+	}
+	req := newPushRequest(c, "my-sub", batch)
+	req.Header.Set(PushVersionAcceptHeader, "1, 2, 3")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	c.Assert(rec.Code, qt.Equals, http.StatusOK)
+	c.Assert(rec.Header().Get(PushVersionHeader), qt.Equals, "3")
+	c.Assert(maxRunning, qt.Equals, 2)
+
+	// Every message gets its own event, in the order they completed
+	events := strings.Split(strings.TrimSuffix(rec.Body.String(), "\n\n"), "\n\n")
+	sort.Strings(events)
+	c.Assert(events, qt.DeepEquals, []string{
+		"event: ack\ndata: {\"message_id\":\"msg-1\"}",
+		"event: ack\ndata: {\"message_id\":\"msg-2\"}",
+		"event: ack\ndata: {\"message_id\":\"msg-4\"}",
+		"event: ack\ndata: {\"message_id\":\"msg-5\"}",
+		"event: nack\ndata: {\"message_id\":\"msg-3\",\"error\":\"busy\",\"retry_after_ms\":1000}",
+	})
+
+	sort.Strings(m.pushes)
+	c.Assert(m.pushes, qt.DeepEquals, []string{"my-sub ack", "my-sub ack", "my-sub ack", "my-sub ack", "my-sub nack"})
+}
+
+func TestCompressedPush(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		encoding   string
+		wantStatus int
+	}{
+		{name: "gzip", encoding: "gzip", wantStatus: http.StatusOK},
+		{name: "zstd", encoding: "zstd", wantStatus: http.StatusOK},
+		{name: "unsupported", encoding: "br", wantStatus: http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := qt.New(t)
+
+			var received []byte
+			handler := newTestClient("").CreateSubscriptionHandler("my-sub", &zerolog.Logger{}, func(ctx context.Context, msgID string, publishTime time.Time, deliveryAttempt int, attrs map[string]string, data []byte) error {
+				received = data
+				return nil
+			})
+
+			req := newPushRequest(c, "my-sub", &types.SubscriptionPushParams{
+				Data:            []byte(`{"hello":"world"}`),
+				MessageID:       "msg-1",
+				PublishTime:     time.Now(),
+				DeliveryAttempt: 1,
+			})
+			body, err := io.ReadAll(req.Body)
+			c.Assert(err, qt.IsNil)
+			if tt.encoding != "br" {
+				body, err = client.Compress(client.Compression(tt.encoding), body)
+				c.Assert(err, qt.IsNil)
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			req.Header.Set("Content-Encoding", tt.encoding)
+
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			c.Assert(rec.Code, qt.Equals, tt.wantStatus)
+			c.Assert(rec.Header().Get("Accept-Encoding"), qt.Equals, client.AcceptedEncodings)
+			if tt.wantStatus == http.StatusOK {
+				c.Assert(rec.Body.String(), qt.Contains, "event: ack")
+				c.Assert(string(received), qt.Equals, `{"hello":"world"}`)
+			}
+		})
+	}
+}
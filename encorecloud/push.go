@@ -0,0 +1,219 @@
+package encorecloud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.encore.dev/platform-sdk/encorecloud/types"
+	"go.encore.dev/platform-sdk/internal/client"
+	"go.encore.dev/platform-sdk/internal/jsonerr"
+	"go.encore.dev/platform-sdk/pkg/auth"
+	"go.encore.dev/platform-sdk/pkg/logging"
+	"go.encore.dev/platform-sdk/pkg/metrics"
+)
+
+// DefaultMaxConcurrency is the number of messages of a batch a subscription handler processes
+// at the same time, unless configured otherwise with [WithMaxConcurrency].
+const DefaultMaxConcurrency = 10
+
+// SubscriptionOption configures a handler created with [Client.CreateSubscriptionHandler].
+type SubscriptionOption func(*subscriptionOptions)
+
+type subscriptionOptions struct {
+	maxConcurrency int
+}
+
+// WithMaxConcurrency sets the maximum number of messages of a batch pushed to the handler
+// which are processed at the same time (defaults to [DefaultMaxConcurrency]).
+//
+// A value of 1 processes the messages of a batch one after the other.
+func WithMaxConcurrency(n int) SubscriptionOption {
+	return func(opts *subscriptionOptions) {
+		opts.maxConcurrency = n
+	}
+}
+
+func newSubscriptionOptions(options []SubscriptionOption) *subscriptionOptions {
+	opts := &subscriptionOptions{maxConcurrency: DefaultMaxConcurrency}
+	for _, option := range options {
+		option(opts)
+	}
+	if opts.maxConcurrency <= 0 {
+		opts.maxConcurrency = 1
+	}
+	return opts
+}
+
+// From push version 3, Encore Cloud will send a POST request to the endpoint with a JSON encoded
+// [types.SubscriptionPushBatchParams] as the body, signed and optionally compressed in the same way
+// as for earlier versions.
+//
+// Once the request is received and verified, the user's subscription function will be called for each message
+// of the batch, with up to the configured maximum concurrency, while an event stream is sent back to Encore Cloud
+// with keepalive messages every 5 seconds. As each message completes, an event is sent for it:
+// - "ack" - A JSON encoded [types.SubscriptionAck] confirming the message was processed successfully.
+// - "nack" - A JSON encoded [types.SubscriptionNack] telling the server the message failed, and whether and when
+// it should be retried.
+//
+// The event stream is closed once every message has been acked or nacked. Any message Encore Cloud has not
+// received an event for by then is nacked and retried.
+//
+// A batch never contains two messages with the same ordering key, so messages processed concurrently
+// never need to be ordered with respect to each other.
+//
+// If the request is closed by Encore Cloud before every message has completed, the context of the subscription
+// functions still running is cancelled.
+func subscriptionHandlerV3(w http.ResponseWriter, req *http.Request, c *Client, subscriptionID string, logger logging.Logger, callback types.SubscriptionCallback, opts *subscriptionOptions) {
+	// Decode the request
+	payload := &types.SubscriptionPushBatchParams{}
+	err := c.client.VerifyAndDecodeRequest(
+		req,
+		auth.PubsubMsg, auth.Read,
+		payload,
+		[]byte(subscriptionID),
+	)
+	if errors.Is(err, client.ErrUnsupportedEncoding) {
+		logger.Error("PubSub push endpoint received a request with an unsupported content encoding", "subscription", subscriptionID, "error", err)
+		w.Header().Set("Accept-Encoding", client.AcceptedEncodings)
+		jsonerr.Error(w, err, http.StatusUnsupportedMediaType)
+		return
+	} else if errors.Is(err, client.ErrRequestBodyTooLarge) {
+		logger.Error("PubSub push endpoint received a request which is too large", "subscription", subscriptionID, "error", err)
+		jsonerr.Error(w, err, http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		logger.Error("error while verifying PubSub subscription message", "subscription", subscriptionID, "error", err)
+		jsonerr.Error(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// Ensure we can flush the responses
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		err = errors.New("unable to cast http.ResponseWriter to http.Flusher")
+		logger.Error("error while setting up flushing response", "subscription", subscriptionID, "error", err)
+		jsonerr.Error(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// Start the event stream, advertising the encodings we accept for future push requests
+	w.Header().Set(PushVersionHeader, "3")
+	w.Header().Set("Accept-Encoding", client.AcceptedEncodings)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// Events are sent by the goroutines processing the messages, so writes to the stream are
+	// serialised, and stop once the handler has returned as the stream is no longer usable
+	var mu sync.Mutex
+	closed := false
+	defer func() {
+		mu.Lock()
+		closed = true
+		mu.Unlock()
+	}()
+	sendEvent := func(event string, data []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+			logger.Error("error while sending "+event+" message", "subscription", subscriptionID, "error", err)
+		}
+		flusher.Flush()
+	}
+
+	// Process the messages in goroutines, limited to the maximum concurrency
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		var wg sync.WaitGroup
+		defer wg.Wait()
+		sem := make(chan struct{}, opts.maxConcurrency)
+		for _, msg := range payload.Messages {
+			if msg == nil {
+				continue
+			}
+			select {
+			case sem <- struct{}{}:
+			case <-req.Context().Done():
+				return
+			}
+
+			wg.Add(1)
+			go func(msg *types.SubscriptionPushParams) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				if err := c.processPushedMessage(req.Context(), subscriptionID, logger, callback, msg); err != nil {
+					nack := nackFor(err)
+					nack.MessageID = msg.MessageID
+					data, _ := json.Marshal(nack)
+					sendEvent("nack", data)
+				} else if req.Context().Err() == nil {
+					data, _ := json.Marshal(&types.SubscriptionAck{MessageID: msg.MessageID})
+					sendEvent("ack", data)
+				}
+			}(msg)
+		}
+	}()
+
+	// Wait for every message to complete or the request to be cancelled
+	keepAliveTimeout := time.NewTicker(KeepAliveInterval)
+	defer keepAliveTimeout.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			logger.Error("PubSub push endpoint closed by Encore Cloud before subscription functions completed", "subscription", subscriptionID, "error", req.Context().Err())
+			return
+
+		case <-keepAliveTimeout.C:
+			sendEvent("keepalive", nil)
+
+		case <-done:
+			return
+		}
+	}
+}
+
+// processPushedMessage calls the subscription function for a message pushed in a batch,
+// tracing it and recording its outcome.
+func (c *Client) processPushedMessage(ctx context.Context, subscriptionID string, logger logging.Logger, callback types.SubscriptionCallback, msg *types.SubscriptionPushParams) (err error) {
+	ctx, span := c.startProcessSpan(ctx, subscriptionID, msg)
+	start := c.client.Clock().Now()
+	lag := start.Sub(msg.PublishTime)
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while processing PubSub message: %v", r)
+		}
+
+		outcome, spanErr := metrics.Ack, err
+		switch {
+		case ctx.Err() != nil:
+			outcome, spanErr = metrics.Cancelled, ctx.Err()
+			logger.Error("PubSub push endpoint closed by Encore Cloud before subscription function completed", "subscription", subscriptionID, "message_id", msg.MessageID, "error", ctx.Err())
+		case err != nil:
+			outcome = metrics.Nack
+			logger.Error("error while handling PubSub subscription message", "subscription", subscriptionID, "message_id", msg.MessageID, "error", err)
+		}
+		endSpan(span, spanErr)
+		c.client.Metrics().ObservePush(subscriptionID, outcome, c.client.Clock().Since(start), msg.DeliveryAttempt, lag)
+	}()
+
+	return callback(
+		ctx,
+		msg.MessageID, msg.PublishTime, msg.DeliveryAttempt,
+		msg.Attributes, msg.Data,
+	)
+}
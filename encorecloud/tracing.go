@@ -0,0 +1,80 @@
+package encorecloud
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"go.encore.dev/platform-sdk/encorecloud/types"
+)
+
+// messagingSystem is the value of the messaging.system span attribute.
+const messagingSystem = "encore_cloud"
+
+// startPublishSpan starts a producer span for publishing a message to the given topic and
+// returns the attributes to publish with the trace context of the span injected into them.
+//
+// If tracing is not enabled, the attributes are returned unchanged.
+func (c *Client) startPublishSpan(ctx context.Context, topicID string, attrs map[string]string) (context.Context, trace.Span, map[string]string) {
+	if !c.client.TracingEnabled() {
+		return ctx, noopSpan(), attrs
+	}
+
+	ctx, span := c.client.Tracer().Start(ctx, topicID+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", messagingSystem),
+			attribute.String("messaging.operation", "publish"),
+			attribute.String("messaging.destination.name", topicID),
+		),
+	)
+
+	// Copy the attributes so we don't modify the caller's map
+	withTraceContext := make(map[string]string, len(attrs)+2)
+	for k, v := range attrs {
+		withTraceContext[k] = v
+	}
+	propagation.TraceContext{}.Inject(ctx, propagation.MapCarrier(withTraceContext))
+
+	return ctx, span, withTraceContext
+}
+
+// startProcessSpan starts a consumer span for processing a pushed message, which is
+// a child of the span which published the message if its trace context was propagated
+// through the message attributes.
+//
+// If tracing is not enabled, the context is returned unchanged.
+func (c *Client) startProcessSpan(ctx context.Context, subscriptionID string, msg *types.SubscriptionPushParams) (context.Context, trace.Span) {
+	if !c.client.TracingEnabled() {
+		return ctx, noopSpan()
+	}
+
+	ctx = propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier(msg.Attributes))
+	return c.client.Tracer().Start(ctx, subscriptionID+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", messagingSystem),
+			attribute.String("messaging.operation", "process"),
+			attribute.String("messaging.message.id", msg.MessageID),
+			attribute.Int("messaging.delivery_attempt", msg.DeliveryAttempt),
+			attribute.String("encore.subscription_id", subscriptionID),
+		),
+	)
+}
+
+// endSpan ends a span started by this package, recording the error if there was one.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// noopSpan returns a span which does nothing, used when tracing is disabled.
+func noopSpan() trace.Span {
+	return trace.SpanFromContext(context.Background())
+}
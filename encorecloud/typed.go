@@ -0,0 +1,243 @@
+package encorecloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	"go.encore.dev/platform-sdk/encorecloud/types"
+)
+
+// AttrTag is the struct tag which maps a string field of a message type used with [Topic]
+// or [Subscription] to a message attribute, for instance:
+//
+//	type OrderPlaced struct {
+//		OrderID string `json:"order_id"`
+//		Region  string `json:"-" pubsub-attr:"region"`
+//	}
+//
+// Attribute fields are still encoded in the payload unless they are excluded from it
+// by the codec, as the json:"-" tag does above.
+const AttrTag = "pubsub-attr"
+
+// Codec encodes and decodes the payloads of messages published with [Topic] and
+// received by [Subscription].
+//
+// Payloads are sent to Encore Cloud as JSON, so Marshal must return valid JSON;
+// codecs for binary formats should encode their output as a JSON string.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// JSONCodec is the default [Codec], which encodes payloads using encoding/json.
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v) // nolint: wrapcheck
+}
+
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v) // nolint: wrapcheck
+}
+
+// TypedOption configures a [Topic] or [Subscription].
+type TypedOption func(*typedConfig)
+
+type typedConfig struct {
+	codec             Codec
+	orderingAttribute string
+}
+
+// WithCodec sets the codec used to encode and decode message payloads (defaults to [JSONCodec]).
+func WithCodec(codec Codec) TypedOption {
+	return func(cfg *typedConfig) {
+		cfg.codec = codec
+	}
+}
+
+// WithOrderingAttribute publishes messages with the value of the given attribute as their
+// ordering key, so that messages with the same value are delivered in order. It is only
+// used by [Topic].
+func WithOrderingAttribute(attr string) TypedOption {
+	return func(cfg *typedConfig) {
+		cfg.orderingAttribute = attr
+	}
+}
+
+func newTypedConfig(options []TypedOption) typedConfig {
+	cfg := typedConfig{codec: JSONCodec{}}
+	for _, option := range options {
+		option(&cfg)
+	}
+	return cfg
+}
+
+// attrFields maps the attribute names of a message type to the indexes of their fields.
+type attrFields map[string][]int
+
+// attrFieldsOf returns the attribute fields of T, which must be a struct or a pointer to one
+// if it has any. It panics if a field tagged with [AttrTag] is not a string.
+func attrFieldsOf[T any]() attrFields {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil
+	}
+
+	fields := make(attrFields)
+	for _, field := range reflect.VisibleFields(typ) {
+		name, ok := field.Tag.Lookup(AttrTag)
+		if !ok || !field.IsExported() {
+			continue
+		}
+		if field.Type.Kind() != reflect.String {
+			panic(fmt.Sprintf("encorecloud: %s field %s.%s must be a string, not %s", AttrTag, typ, field.Name, field.Type))
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Index
+	}
+	return fields
+}
+
+// structValue returns the struct v holds or points to, or false if there is none.
+func structValue(v reflect.Value) (reflect.Value, bool) {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return reflect.Value{}, false
+		}
+		v = v.Elem()
+	}
+	return v, v.Kind() == reflect.Struct
+}
+
+// get returns the non-empty attribute values of msg.
+func (f attrFields) get(msg any) map[string]string {
+	v, ok := structValue(reflect.ValueOf(msg))
+	if !ok || len(f) == 0 {
+		return nil
+	}
+	attrs := make(map[string]string, len(f))
+	for name, index := range f {
+		// Fields promoted through nil embedded pointers are skipped
+		if field, err := v.FieldByIndexErr(index); err == nil && field.String() != "" {
+			attrs[name] = field.String()
+		}
+	}
+	return attrs
+}
+
+// set sets the attribute fields of the message msg points to from attrs.
+func (f attrFields) set(msg any, attrs map[string]string) {
+	v, ok := structValue(reflect.ValueOf(msg).Elem())
+	if !ok {
+		return
+	}
+	for name, index := range f {
+		if value, found := attrs[name]; found {
+			if field, err := v.FieldByIndexErr(index); err == nil {
+				field.SetString(value)
+			}
+		}
+	}
+}
+
+// Topic is a typed wrapper around a topic, which encodes messages of type T using
+// its codec and maps their attribute fields to message attributes (see [AttrTag]).
+type Topic[T any] struct {
+	client *Client
+	id     string
+	cfg    typedConfig
+	attrs  attrFields
+}
+
+// NewTopic returns a typed wrapper for publishing messages of type T to the topic
+// specified by topicID.
+//
+// It panics if T has a field tagged with [AttrTag] which is not a string.
+func NewTopic[T any](c *Client, topicID string, options ...TypedOption) *Topic[T] {
+	return &Topic[T]{
+		client: c,
+		id:     topicID,
+		cfg:    newTypedConfig(options),
+		attrs:  attrFieldsOf[T](),
+	}
+}
+
+// ID returns the ID of the topic.
+func (t *Topic[T]) ID() string {
+	return t.id
+}
+
+// Publish encodes and publishes the message, see [Client.PublishToTopic].
+func (t *Topic[T]) Publish(ctx context.Context, msg T, options ...PublishOption) (msgID string, err error) {
+	data, err := t.cfg.codec.Marshal(msg)
+	if err != nil {
+		return "", fmt.Errorf("unable to encode message: %w", err)
+	}
+	attrs := t.attrs.get(msg)
+
+	return t.client.PublishToTopic(ctx, t.id, attrs[t.cfg.orderingAttribute], attrs, data, options...)
+}
+
+// Subscription is a typed wrapper around a subscription, which decodes the messages pushed
+// to it as values of type T using its codec and sets their attribute fields from the message
+// attributes (see [AttrTag]).
+//
+// Messages which can't be decoded fail with a [Permanent] error, as redelivering them
+// would never succeed. Push version 1 can't tell Encore Cloud a failure is permanent, so
+// when a message is pushed with it the failure is an ordinary nack: the message is
+// redelivered like any other failed message until the subscription's maximum number of
+// delivery attempts is exhausted and it is dead-lettered, or indefinitely if the
+// subscription doesn't limit delivery attempts.
+type Subscription[T any] struct {
+	client  *Client
+	id      string
+	cfg     typedConfig
+	attrs   attrFields
+	handler func(ctx context.Context, msg T) error
+}
+
+// NewSubscription returns a typed wrapper for the subscription specified by subscriptionID,
+// which calls handler with each message pushed to it.
+//
+// It panics if T has a field tagged with [AttrTag] which is not a string.
+func NewSubscription[T any](c *Client, subscriptionID string, handler func(ctx context.Context, msg T) error, options ...TypedOption) *Subscription[T] {
+	return &Subscription[T]{
+		client:  c,
+		id:      subscriptionID,
+		cfg:     newTypedConfig(options),
+		attrs:   attrFieldsOf[T](),
+		handler: handler,
+	}
+}
+
+// ID returns the ID of the subscription.
+func (s *Subscription[T]) ID() string {
+	return s.id
+}
+
+// Handler returns the push endpoint handler of the subscription, see [Client.CreateSubscriptionHandler].
+func (s *Subscription[T]) Handler(options ...SubscriptionOption) http.HandlerFunc {
+	return s.client.CreateSubscriptionHandler(s.id, nil, s.Callback(), options...)
+}
+
+// Callback returns a [types.SubscriptionCallback] which decodes messages and passes them to the handler.
+func (s *Subscription[T]) Callback() types.SubscriptionCallback {
+	return func(ctx context.Context, msgID string, publishTime time.Time, deliveryAttempt int, attrs map[string]string, data []byte) error {
+		var msg T
+		if err := s.cfg.codec.Unmarshal(data, &msg); err != nil {
+			return Permanent(fmt.Errorf("unable to decode message: %w", err))
+		}
+		s.attrs.set(&msg, attrs)
+
+		return s.handler(ctx, msg)
+	}
+}
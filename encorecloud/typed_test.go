@@ -0,0 +1,80 @@
+package encorecloud
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"go.encore.dev/platform-sdk/encorecloud/types"
+)
+
+type orderPlaced struct {
+	OrderID string `json:"order_id"`
+	Region  string `json:"-" pubsub-attr:"region"`
+	Tenant  string `pubsub-attr:""`
+}
+
+func TestTypedTopicAndSubscription(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	var published types.PublishParams
+	platform := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c.Check(json.NewDecoder(req.Body).Decode(&published), qt.IsNil)
+		_ = json.NewEncoder(w).Encode(&types.PublishResponse{MessageID: "msg-1"})
+	}))
+	defer platform.Close()
+	cl := newTestClient(platform.URL)
+
+	// Publish a typed message, mapping its attribute fields to attributes
+	topic := NewTopic[*orderPlaced](cl, "orders", WithOrderingAttribute("region"))
+	msgID, err := topic.Publish(context.Background(), &orderPlaced{OrderID: "o-1", Region: "eu", Tenant: "acme"})
+	c.Assert(err, qt.IsNil)
+	c.Assert(msgID, qt.Equals, "msg-1")
+	c.Assert(string(published.Payload), qt.Equals, `{"order_id":"o-1","Tenant":"acme"}`)
+	c.Assert(published.Attributes, qt.DeepEquals, map[string]string{"region": "eu", "Tenant": "acme"})
+	c.Assert(published.OrderingKey, qt.Equals, "eu")
+
+	// Push it to a typed subscription, which decodes it and sets its attribute fields
+	var received []orderPlaced
+	sub := NewSubscription(cl, "ship", func(ctx context.Context, msg orderPlaced) error {
+		received = append(received, msg)
+		return nil
+	})
+	push := func(data string) string {
+		rec := httptest.NewRecorder()
+		req := newPushRequest(c, "ship", &types.SubscriptionPushParams{
+			Data:            []byte(data),
+			Attributes:      published.Attributes,
+			MessageID:       "msg-1",
+			PublishTime:     time.Now(),
+			DeliveryAttempt: 1,
+		})
+		req.Header.Set(PushVersionAcceptHeader, "1, 2")
+		sub.Handler()(rec, req)
+		return rec.Body.String()
+	}
+	c.Assert(push(string(published.Payload)), qt.Contains, "event: ack")
+	c.Assert(received, qt.DeepEquals, []orderPlaced{{OrderID: "o-1", Region: "eu", Tenant: "acme"}})
+
+	// Messages which can't be decoded are dead-lettered rather than redelivered
+	c.Assert(push(`{"order_id": 1}`), qt.Contains, `event: nack
+data: {"error":"unable to decode message: json: cannot unmarshal number into Go struct field orderPlaced.order_id of type string","permanent":true}`)
+	c.Assert(received, qt.HasLen, 1)
+}
+
+func TestTypedTopic_InvalidAttrField(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	type invalid struct {
+		Count int `pubsub-attr:"count"`
+	}
+	c.Assert(func() { NewTopic[invalid](newTestClient("http://localhost"), "counts") }, qt.PanicMatches,
+		`encorecloud: pubsub-attr field encorecloud.invalid.Count must be a string, not int`)
+}
@@ -0,0 +1,11 @@
+package types
+
+import (
+	"time"
+)
+
+// PingResponse is the response from pinging Encore Cloud.
+type PingResponse struct {
+	ServerTime  time.Time `json:"server_time"`  // The time on the server when the ping was handled.
+	APIVersions []string  `json:"api_versions"` // The API versions supported by the server.
+}
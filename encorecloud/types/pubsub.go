@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 )
 
@@ -12,8 +13,20 @@ type PublishParams struct {
 	Attributes  map[string]string `json:"attributes,omitempty" encore:"sensitive"`   // Optional attributes for this message.
 	OrderingKey string            `json:"ordering_key,omitempty" encore:"sensitive"` // Optional grouping key for this message.
 	Payload     json.RawMessage   `json:"payload" encore:"sensitive"`                // The message payload.
+	DeliverAt   *time.Time        `json:"deliver_at,omitempty"`                      // Optional time to deliver the message at, rather than immediately.
+
+	// Optional delay in milliseconds after which to deliver the message, rather than immediately,
+	// as measured by Encore Cloud from when it receives the message. It can't be combined with DeliverAt.
+	DeliverAfterMillis int64 `json:"deliver_after_millis,omitempty"`
+
+	// Optional ID identifying the message, such that publishing another message with the same ID
+	// to the topic within the deduplication window returns the original message instead.
+	DeduplicationID string `json:"deduplication_id,omitempty"`
 }
 
+// MaxDeduplicationIDLength is the maximum length of [PublishParams.DeduplicationID].
+const MaxDeduplicationIDLength = 128
+
 func (p *PublishParams) DeterministicBytes() []byte {
 	b, _ := json.Marshal(p)
 	return b
@@ -23,6 +36,15 @@ func (p *PublishParams) Validate() error {
 	if len(p.Payload) == 0 {
 		return errors.New("payload must be provided")
 	}
+	if len(p.DeduplicationID) > MaxDeduplicationIDLength {
+		return fmt.Errorf("deduplication ID must be at most %d characters", MaxDeduplicationIDLength)
+	}
+	if p.DeliverAfterMillis < 0 {
+		return errors.New("deliver after must not be negative")
+	}
+	if p.DeliverAt != nil && p.DeliverAfterMillis != 0 {
+		return errors.New("only one of deliver at and deliver after can be provided")
+	}
 
 	return nil
 }
@@ -30,6 +52,38 @@ func (p *PublishParams) Validate() error {
 // PublishResponse is the response from publishing a message to a topic.
 type PublishResponse struct {
 	MessageID string `json:"message_id"`
+	Duplicate bool   `json:"duplicate,omitempty"` // Whether the message was a duplicate of one already published, whose ID is returned.
+}
+
+// PublishBatchParams is the parameters for publishing a batch of messages to a topic.
+type PublishBatchParams struct {
+	Messages []*PublishParams `json:"messages"` // The messages to publish, in order.
+}
+
+func (p *PublishBatchParams) DeterministicBytes() []byte {
+	b, _ := json.Marshal(p)
+	return b
+}
+
+func (p *PublishBatchParams) Validate() error {
+	if len(p.Messages) == 0 {
+		return errors.New("at least one message must be provided")
+	}
+
+	return nil
+}
+
+// PublishBatchResponse is the response from publishing a batch of messages to a topic.
+type PublishBatchResponse struct {
+	Results []*PublishBatchResult `json:"results"` // The result of publishing each message, in the order they were given.
+}
+
+// PublishBatchResult is the result of publishing a single message of a batch,
+// which either has a message ID if it was published or an error if it was not.
+type PublishBatchResult struct {
+	MessageID string `json:"message_id,omitempty"`
+	Duplicate bool   `json:"duplicate,omitempty"`
+	Error     string `json:"error,omitempty"`
 }
 
 // SubscriptionPushParams is the payload that Encore Cloud will generate
@@ -47,6 +101,34 @@ func (s *SubscriptionPushParams) DeterministicBytes() []byte {
 	return b
 }
 
+// SubscriptionPushBatchParams is the payload that Encore Cloud will generate
+// when pushing a batch of messages to a push endpoint using push version 3.
+//
+// A batch never contains more than one message with the same ordering key.
+type SubscriptionPushBatchParams struct {
+	Messages []*SubscriptionPushParams `json:"messages"`
+}
+
+func (s *SubscriptionPushBatchParams) DeterministicBytes() []byte {
+	b, _ := json.Marshal(s)
+	return b
+}
+
+// SubscriptionAck is the data of an ack event sent in response to a batch push request
+// using push version 3.
+type SubscriptionAck struct {
+	MessageID string `json:"message_id"` // The message which was processed successfully.
+}
+
+// SubscriptionNack is the data of a nack event sent in response to a push request
+// from push version 2 onwards.
+type SubscriptionNack struct {
+	MessageID        string `json:"message_id,omitempty"`     // The message which failed to be processed, from push version 3.
+	Error            string `json:"error"`                    // Why the message failed to be processed.
+	RetryAfterMillis int64  `json:"retry_after_ms,omitempty"` // Optional delay before the message is redelivered, in milliseconds.
+	Permanent        bool   `json:"permanent,omitempty"`      // Whether the message should be dead-lettered rather than redelivered.
+}
+
 // SubscriptionCallback is the callback function that will be invoked when a subscription
 // receives a message.
 type SubscriptionCallback = func(ctx context.Context, msgID string, publishTime time.Time, deliveryAttempt int, attrs map[string]string, data []byte) error
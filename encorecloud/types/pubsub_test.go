@@ -0,0 +1,68 @@
+package types
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestPublishParams_Validate(t *testing.T) {
+	t.Parallel()
+
+	deliverAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		params  PublishParams
+		wantErr string
+	}{
+		{
+			name:   "ok",
+			params: PublishParams{Payload: []byte(`{}`)},
+		},
+		{
+			name:    "no payload",
+			params:  PublishParams{},
+			wantErr: "payload must be provided",
+		},
+		{
+			name:    "deduplication ID too long",
+			params:  PublishParams{Payload: []byte(`{}`), DeduplicationID: strings.Repeat("a", MaxDeduplicationIDLength+1)},
+			wantErr: "deduplication ID must be at most 128 characters",
+		},
+		{
+			name:   "deliver at",
+			params: PublishParams{Payload: []byte(`{}`), DeliverAt: &deliverAt},
+		},
+		{
+			name:   "deliver after",
+			params: PublishParams{Payload: []byte(`{}`), DeliverAfterMillis: 1000},
+		},
+		{
+			name:    "negative deliver after",
+			params:  PublishParams{Payload: []byte(`{}`), DeliverAfterMillis: -1000},
+			wantErr: "deliver after must not be negative",
+		},
+		{
+			name:    "deliver at and deliver after",
+			params:  PublishParams{Payload: []byte(`{}`), DeliverAt: &deliverAt, DeliverAfterMillis: 1000},
+			wantErr: "only one of deliver at and deliver after can be provided",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := qt.New(t)
+
+			err := tt.params.Validate()
+			if tt.wantErr != "" {
+				c.Assert(err, qt.ErrorMatches, tt.wantErr)
+			} else {
+				c.Assert(err, qt.IsNil)
+			}
+		})
+	}
+}
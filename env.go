@@ -0,0 +1,76 @@
+package platform
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.encore.dev/platform-sdk/pkg/auth"
+)
+
+// The environment variables read by [NewSDKFromEnv].
+const (
+	// EnvHost is the URL of the Encore Platform, for example "https://platform.encore.cloud".
+	EnvHost = "ENCORE_PLATFORM_HOST"
+
+	// EnvAppSlug is the slug of the application the SDK acts on behalf of.
+	EnvAppSlug = "ENCORE_PLATFORM_APP_SLUG"
+
+	// EnvEnvName is the name of the environment the SDK acts on behalf of.
+	EnvEnvName = "ENCORE_PLATFORM_ENV_NAME"
+
+	// EnvAuthKeys is a JSON encoded array of the auth keys to use, in the same format as
+	// [auth.Key] is encoded, for example:
+	//
+	//	[{"kid": 1, "data": "<base64 encoded key data>"}]
+	EnvAuthKeys = "ENCORE_PLATFORM_AUTH_KEYS"
+)
+
+// NewSDKFromEnv creates a new SDK configured from the [EnvHost], [EnvAppSlug], [EnvEnvName]
+// and [EnvAuthKeys] environment variables.
+//
+// Any options given are applied after the environment has been read, so they take precedence
+// over it. Like [New], it returns an error if the resulting configuration is not valid.
+func NewSDKFromEnv(options ...Option) (*SDK, error) {
+	return newSDKFromLookup(os.LookupEnv, options...)
+}
+
+// newSDKFromLookup implements [NewSDKFromEnv] using the given function to read the environment.
+func newSDKFromLookup(lookup func(key string) (string, bool), options ...Option) (*SDK, error) {
+	envOptions, err := optionsFromLookup(lookup)
+	if err != nil {
+		return nil, err
+	}
+	return New(append(envOptions, options...)...)
+}
+
+// optionsFromLookup returns the options configured by the environment.
+func optionsFromLookup(lookup func(key string) (string, bool)) ([]Option, error) {
+	var options []Option
+
+	if host, ok := lookup(EnvHost); ok {
+		options = append(options, WithHost(host))
+	}
+
+	appSlug, hasAppSlug := lookup(EnvAppSlug)
+	envName, hasEnvName := lookup(EnvEnvName)
+	if hasAppSlug || hasEnvName {
+		options = append(options, WithAppDetails(appSlug, envName))
+	}
+
+	if keysJSON, ok := lookup(EnvAuthKeys); ok {
+		var keys []auth.Key
+		if err := json.Unmarshal([]byte(keysJSON), &keys); err != nil {
+			// Don't wrap the error, as it may contain part of the secret key data
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				return nil, fmt.Errorf("invalid %s: malformed JSON at offset %d", EnvAuthKeys, syntaxErr.Offset)
+			}
+			return nil, fmt.Errorf("invalid %s: expected a JSON array of {\"kid\": number, \"data\": base64 string} objects", EnvAuthKeys)
+		}
+		options = append(options, WithAuthKeys(keys...))
+	}
+
+	return options, nil
+}
@@ -0,0 +1,235 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+
+	"go.encore.dev/platform-sdk/pkg/auth"
+)
+
+// ErrCircuitOpen is returned when a request is not sent because the circuit breaker
+// for its operation is open. The returned error is a [*CircuitOpenError].
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState int
+
+const (
+	CircuitClosed   CircuitState = iota // Requests are sent as normal
+	CircuitOpen                         // Requests fail fast without being sent
+	CircuitHalfOpen                     // A limited number of trial requests are sent to test if the platform has recovered
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+}
+
+// OperationKey identifies the operation a circuit breaker is tracking.
+type OperationKey struct {
+	Object       auth.ObjectType
+	Action       auth.ActionType
+	PathTemplate string
+}
+
+func (k OperationKey) String() string {
+	return fmt.Sprintf("%s %s %s", k.Object, k.Action, k.PathTemplate)
+}
+
+// CircuitOpenError is the error returned when a request fails fast because
+// the circuit breaker for its operation is open.
+type CircuitOpenError struct {
+	Operation OperationKey  // The operation the circuit breaker is tracking
+	RetryIn   time.Duration // How long until the circuit breaker will allow a trial request
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s for %s, retry in %s", ErrCircuitOpen, e.Operation, e.RetryIn)
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// CircuitBreakerConfig configures the circuit breakers used by the client.
+//
+// A separate circuit breaker is kept for each operation, identified by its [OperationKey].
+// A closed circuit breaker opens once FailureThreshold consecutive requests have failed. While
+// open, requests fail fast with [ErrCircuitOpen] until OpenDuration has passed, at which point
+// the circuit breaker becomes half-open and allows HalfOpenRequests trial requests through. If
+// they all succeed the circuit breaker closes again, if any fail it opens again.
+type CircuitBreakerConfig struct {
+	FailureThreshold int           // The number of consecutive failures which opens the circuit breaker (defaults to 5)
+	OpenDuration     time.Duration // How long the circuit breaker stays open before allowing trial requests (defaults to 30s)
+	HalfOpenRequests int           // The number of successful trial requests required to close the circuit breaker (defaults to 1)
+
+	// IsFailure reports whether a request which returned the given error counts as a failure.
+	//
+	// By default network errors, timeouts and 5xx responses are failures, while
+	// other errors such as 4xx responses, cancelled requests or requests rejected
+	// by the client-side rate limiter are not.
+	IsFailure func(err error) bool
+
+	// OnStateChange is called whenever a circuit breaker changes state. It is called
+	// synchronously while the request is being processed, so it should not block.
+	OnStateChange func(op OperationKey, from, to CircuitState)
+}
+
+func (cfg CircuitBreakerConfig) withDefaults() CircuitBreakerConfig {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.OpenDuration <= 0 {
+		cfg.OpenDuration = 30 * time.Second
+	}
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = 1
+	}
+	if cfg.IsFailure == nil {
+		cfg.IsFailure = isBreakerFailure
+	}
+	return cfg
+}
+
+// isBreakerFailure is the default [CircuitBreakerConfig.IsFailure].
+//
+// Requests rejected by the client itself, because of the rate limit or another
+// open circuit breaker, say nothing about the health of the Encore Platform.
+func isBreakerFailure(err error) bool {
+	var apiErr *APIError
+	switch {
+	case err == nil, errors.Is(err, ErrRateLimited), errors.Is(err, ErrCircuitOpen):
+		return false
+	case errors.As(err, &apiErr):
+		return apiErr.StatusCode >= http.StatusInternalServerError
+	default:
+		return !errors.Is(err, context.Canceled)
+	}
+}
+
+// CircuitBreakerInterceptor returns an [Interceptor] which fails requests fast
+// while the Encore Platform is failing requests for the same operation.
+func CircuitBreakerInterceptor(cfg CircuitBreakerConfig, clock clock.Clock) Interceptor {
+	cfg = cfg.withDefaults()
+
+	var mu sync.Mutex
+	breakers := make(map[OperationKey]*circuitBreaker)
+
+	return func(ctx context.Context, op *Operation, req *http.Request, next Invoker) (*http.Response, error) {
+		if isProbe(ctx) {
+			return next(ctx, op, req)
+		}
+		key := op.Key()
+
+		mu.Lock()
+		breaker, found := breakers[key]
+		if !found {
+			breaker = &circuitBreaker{key: key, cfg: &cfg, clock: clock}
+			breakers[key] = breaker
+		}
+		mu.Unlock()
+
+		if err := breaker.allow(); err != nil {
+			return nil, err
+		}
+
+		resp, err := next(ctx, op, req)
+		breaker.done(cfg.IsFailure(err))
+		return resp, err
+	}
+}
+
+// circuitBreaker tracks the state of a single operation.
+type circuitBreaker struct {
+	key   OperationKey
+	cfg   *CircuitBreakerConfig
+	clock clock.Clock
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int       // consecutive failures while closed
+	openedAt time.Time // when the breaker last opened
+	trials   int       // trial requests started while half-open
+	passed   int       // trial requests which succeeded while half-open
+}
+
+// allow reports whether a request may be sent, returning a [*CircuitOpenError] if not.
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitOpen {
+		if elapsed := b.clock.Since(b.openedAt); elapsed < b.cfg.OpenDuration {
+			return &CircuitOpenError{Operation: b.key, RetryIn: b.cfg.OpenDuration - elapsed}
+		}
+		b.setState(CircuitHalfOpen)
+	}
+
+	if b.state == CircuitHalfOpen {
+		if b.trials >= b.cfg.HalfOpenRequests {
+			return &CircuitOpenError{Operation: b.key}
+		}
+		b.trials++
+	}
+
+	return nil
+}
+
+// done records the result of a request which was allowed.
+func (b *circuitBreaker) done(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.cfg.FailureThreshold {
+			b.setState(CircuitOpen)
+		}
+
+	case CircuitHalfOpen:
+		if failed {
+			b.setState(CircuitOpen)
+			return
+		}
+		b.passed++
+		if b.passed >= b.cfg.HalfOpenRequests {
+			b.setState(CircuitClosed)
+		}
+
+	case CircuitOpen:
+		// A request started before the breaker opened, its result no longer matters
+	}
+}
+
+// setState transitions the breaker to the given state, the caller must hold b.mu.
+func (b *circuitBreaker) setState(state CircuitState) {
+	from := b.state
+	b.state = state
+	b.failures, b.trials, b.passed = 0, 0, 0
+	if state == CircuitOpen {
+		b.openedAt = b.clock.Now()
+	}
+
+	if b.cfg.OnStateChange != nil && from != state {
+		b.cfg.OnStateChange(b.key, from, state)
+	}
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	qt "github.com/frankban/quicktest"
+
+	"go.encore.dev/platform-sdk/pkg/auth"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	mockClock := clock.NewMock()
+	var transitions []string
+	interceptor := CircuitBreakerInterceptor(CircuitBreakerConfig{
+		FailureThreshold: 3,
+		OpenDuration:     10 * time.Second,
+		HalfOpenRequests: 2,
+		OnStateChange: func(op OperationKey, from, to CircuitState) {
+			transitions = append(transitions, op.PathTemplate+": "+from.String()+" -> "+to.String())
+		},
+	}, mockClock)
+
+	var sent int
+	var nextErr error
+	next := func(ctx context.Context, op *Operation, req *http.Request) (*http.Response, error) {
+		sent++
+		if nextErr != nil {
+			return nil, nextErr
+		}
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}
+
+	publish := &Operation{Object: auth.PubsubMsg, Action: auth.Create, Path: "/v1/pubsub/a/publish", PathTemplate: "/v1/pubsub/{topic}/publish"}
+	other := &Operation{Object: auth.PubsubMsg, Action: auth.Read, Path: "/v1/other", PathTemplate: "/v1/other"}
+	call := func(op *Operation) error {
+		_, err := interceptor(context.Background(), op, &http.Request{}, next)
+		return err
+	}
+
+	// Client errors, cancellations and requests rejected by the client don't count as failures
+	for _, err := range []error{
+		&APIError{StatusCode: http.StatusNotFound},
+		context.Canceled,
+		&RateLimitedError{Operation: publish.Key(), RetryIn: time.Second},
+		&CircuitOpenError{Operation: publish.Key(), RetryIn: time.Second},
+	} {
+		nextErr = err
+		for i := 0; i < 5; i++ {
+			c.Assert(call(publish), qt.Equals, nextErr)
+		}
+	}
+	c.Assert(transitions, qt.HasLen, 0)
+
+	// Server errors and network errors do, and open the circuit
+	nextErr = &APIError{StatusCode: http.StatusBadGateway}
+	c.Assert(call(publish), qt.Equals, nextErr)
+	c.Assert(call(publish), qt.Equals, nextErr)
+	nextErr = syscall.ECONNRESET
+	c.Assert(call(publish), qt.Equals, nextErr)
+	c.Assert(transitions, qt.DeepEquals, []string{"/v1/pubsub/{topic}/publish: closed -> open"})
+
+	// While open, requests fail fast without being sent
+	sent = 0
+	mockClock.Add(4 * time.Second)
+	err := call(publish)
+	c.Assert(errors.Is(err, ErrCircuitOpen), qt.IsTrue)
+	var openErr *CircuitOpenError
+	c.Assert(errors.As(err, &openErr), qt.IsTrue)
+	c.Assert(openErr.RetryIn, qt.Equals, 6*time.Second)
+	c.Assert(sent, qt.Equals, 0)
+
+	// Probes bypass the breaker, and don't affect it
+	_, err = interceptor(WithProbe(context.Background(), nil), publish, &http.Request{}, next)
+	c.Assert(err, qt.Equals, nextErr)
+	c.Assert(sent, qt.Equals, 1)
+	c.Assert(errors.Is(call(publish), ErrCircuitOpen), qt.IsTrue)
+	sent = 0
+
+	// Other operations have their own breaker
+	nextErr = nil
+	c.Assert(call(other), qt.IsNil)
+	c.Assert(sent, qt.Equals, 1)
+
+	// Once the open duration has passed, a failed trial request opens the circuit again
+	mockClock.Add(6 * time.Second)
+	nextErr = &APIError{StatusCode: http.StatusServiceUnavailable}
+	c.Assert(call(publish), qt.Equals, nextErr)
+	c.Assert(errors.Is(call(publish), ErrCircuitOpen), qt.IsTrue)
+
+	// After enough successful trial requests, the circuit closes
+	mockClock.Add(10 * time.Second)
+	nextErr = nil
+	c.Assert(call(publish), qt.IsNil)
+	c.Assert(call(publish), qt.IsNil)
+	c.Assert(call(publish), qt.IsNil)
+
+	c.Assert(transitions, qt.DeepEquals, []string{
+		"/v1/pubsub/{topic}/publish: closed -> open",
+		"/v1/pubsub/{topic}/publish: open -> half-open",
+		"/v1/pubsub/{topic}/publish: half-open -> open",
+		"/v1/pubsub/{topic}/publish: open -> half-open",
+		"/v1/pubsub/{topic}/publish: half-open -> closed",
+	})
+}
@@ -0,0 +1,322 @@
+package client
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/benbjohnson/clock"
+
+	"go.encore.dev/platform-sdk/pkg/auth"
+)
+
+// RecorderMode is the mode a [Recorder] operates in.
+type RecorderMode int
+
+const (
+	ReplayOrRecord RecorderMode = iota // Replay the cassette if it exists, otherwise record it
+	Replay                             // Replay the cassette, never sending requests
+	Record                             // Send every request and record a new cassette
+)
+
+// redacted replaces the values of headers which must not be recorded.
+const redacted = "REDACTED"
+
+// Cassette is a recording of interactions with the Encore Platform.
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction is a request sent to the Encore Platform and the response it received.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is a recorded request.
+//
+// The Authorization header is redacted, and the body is stored uncompressed
+// and, if it is JSON, in its canonical form.
+type RecordedRequest struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"` // The path and query of the request
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 bool        `json:"body_base64,omitempty"` // Whether Body is base64 encoded as it is binary
+}
+
+// RecordedResponse is a recorded response, whose body is stored uncompressed.
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 bool        `json:"body_base64,omitempty"` // Whether Body is base64 encoded as it is binary
+}
+
+// RecorderConfig configures a [Recorder].
+type RecorderConfig struct {
+	Mode      RecorderMode      // The mode to operate in
+	Transport http.RoundTripper // The transport requests are sent with when recording (defaults to http.DefaultTransport)
+
+	// AuthKeys are the keys replayed requests must be signed with. If set, replayed requests
+	// must carry a valid signature from one of the keys, however as the requests are signed
+	// at a different time to when they were recorded the age of the signature is not checked.
+	AuthKeys []auth.Key
+}
+
+// Recorder is an [http.RoundTripper] which records the interactions with the Encore Platform
+// to a cassette file, and replays them in later runs without sending any requests.
+//
+// A request is replayed using the first interaction not yet replayed which matches its method,
+// path, query and canonical body. Headers are not matched, as the signature, date and idempotency
+// key of the request differ between runs.
+//
+// When recording, the cassette is written once [Recorder.Save] is called.
+type Recorder struct {
+	path      string
+	cfg       RecorderConfig
+	recording bool
+
+	mu       sync.Mutex
+	cassette Cassette
+	replayed []bool // whether each interaction has been replayed
+}
+
+// NewRecorder returns a [Recorder] for the cassette file at path.
+func NewRecorder(path string, cfg RecorderConfig) (*Recorder, error) {
+	r := &Recorder{path: path, cfg: cfg}
+	if r.cfg.Transport == nil {
+		r.cfg.Transport = http.DefaultTransport
+	}
+
+	if cfg.Mode == Record {
+		r.recording = true
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && cfg.Mode == ReplayOrRecord:
+		r.recording = true
+		return r, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &r.cassette); err != nil {
+		return nil, fmt.Errorf("failed to decode cassette %s: %w", path, err)
+	}
+	r.replayed = make([]bool, len(r.cassette.Interactions))
+	return r, nil
+}
+
+// Recording reports whether the recorder is recording a new cassette, rather than replaying one.
+func (r *Recorder) Recording() bool {
+	return r.recording
+}
+
+// RoundTrip implements [http.RoundTripper].
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorded, err := recordRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.recording {
+		return r.record(req, recorded)
+	}
+	return r.replay(req, recorded)
+}
+
+// record sends the request and records the interaction.
+func (r *Recorder) record(req *http.Request, recorded *RecordedRequest) (*http.Response, error) {
+	resp, err := r.cfg.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err // nolint: wrapcheck
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := Decompress(resp.Header.Get("Content-Encoding"), resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	header := resp.Header.Clone()
+	header.Del("Content-Encoding")
+	header.Del("Content-Length")
+	interaction := &Interaction{
+		Request:  *recorded,
+		Response: RecordedResponse{StatusCode: resp.StatusCode, Header: header},
+	}
+	interaction.Response.Body, interaction.Response.BodyBase64 = encodeBody(data)
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	r.mu.Unlock()
+
+	return interaction.Response.toResponse(req)
+}
+
+// replay returns the response of the first unreplayed interaction matching the request.
+func (r *Recorder) replay(req *http.Request, recorded *RecordedRequest) (*http.Response, error) {
+	if len(r.cfg.AuthKeys) > 0 {
+		if err := verifyIgnoringAge(req, r.cfg.AuthKeys); err != nil {
+			return nil, fmt.Errorf("replayed request is not validly signed: %w", err)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, interaction := range r.cassette.Interactions {
+		if r.replayed[i] || !interaction.Request.matches(recorded) {
+			continue
+		}
+		r.replayed[i] = true
+		return interaction.Response.toResponse(req)
+	}
+	return nil, fmt.Errorf("no recorded interaction in %s matches %s %s", r.path, recorded.Method, recorded.URL)
+}
+
+// Save writes the recorded cassette to its file. It does nothing when replaying.
+func (r *Recorder) Save() error {
+	if !r.recording {
+		return nil
+	}
+
+	r.mu.Lock()
+	data, err := json.MarshalIndent(&r.cassette, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+
+	if err := os.WriteFile(r.path, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// recordRequest returns the recorded form of req, leaving its body readable.
+func recordRequest(req *http.Request) (*RecordedRequest, error) {
+	recorded := &RecordedRequest{
+		Method: req.Method,
+		URL:    req.URL.RequestURI(),
+		Header: req.Header.Clone(),
+	}
+	if recorded.Header.Get("Authorization") != "" {
+		recorded.Header.Set("Authorization", redacted)
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		data, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(data))
+
+		body, err := Decompress(req.Header.Get("Content-Encoding"), io.NopCloser(bytes.NewReader(data)))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = io.ReadAll(body); err != nil {
+			return nil, fmt.Errorf("failed to decompress request body: %w", err)
+		}
+		recorded.Header.Del("Content-Encoding")
+		recorded.Body, recorded.BodyBase64 = encodeBody(canonicalBody(data))
+	}
+
+	return recorded, nil
+}
+
+// matches reports whether the recorded request matches the other request.
+func (r *RecordedRequest) matches(other *RecordedRequest) bool {
+	if r.Method != other.Method || r.URL != other.URL || r.BodyBase64 != other.BodyBase64 {
+		return false
+	}
+	if r.BodyBase64 {
+		return r.Body == other.Body
+	}
+	// Canonicalise the recorded body again, in case the cassette was edited by hand
+	return string(canonicalBody([]byte(r.Body))) == other.Body
+}
+
+// toResponse returns the recorded response as a response to req.
+func (r *RecordedResponse) toResponse(req *http.Request) (*http.Response, error) {
+	body := []byte(r.Body)
+	if r.BodyBase64 {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(r.Body); err != nil {
+			return nil, fmt.Errorf("failed to decode recorded response body: %w", err)
+		}
+	}
+
+	header := r.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// canonicalBody returns the canonical form of a JSON body, with its whitespace removed
+// and the keys of its objects sorted. Other bodies are returned as is.
+func canonicalBody(data []byte) []byte {
+	var value any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil || decoder.More() {
+		return data
+	}
+	canonical, err := json.Marshal(value)
+	if err != nil {
+		return data
+	}
+	return canonical
+}
+
+// encodeBody returns the body as a string, base64 encoding it if it is binary.
+func encodeBody(data []byte) (body string, isBase64 bool) {
+	if utf8.Valid(data) {
+		return string(data), false
+	}
+	return base64.StdEncoding.EncodeToString(data), true
+}
+
+// verifyIgnoringAge verifies the request is signed by one of the keys,
+// without checking how long ago it was signed.
+func verifyIgnoringAge(req *http.Request, keys []auth.Key) error {
+	signedAt, err := http.ParseTime(req.Header.Get("Date"))
+	if err != nil {
+		return fmt.Errorf("invalid Date header: %w", err)
+	}
+	signingClock := clock.NewMock()
+	signingClock.Set(signedAt)
+
+	if _, err := auth.GetVerifiedOperationHash(req, keys, signingClock); err != nil {
+		return err // nolint: wrapcheck
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	qt "github.com/frankban/quicktest"
+
+	"go.encore.dev/platform-sdk/pkg/auth"
+)
+
+func TestRecorder(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	srv := &testServer{}
+	httpSrv := httptest.NewServer(srv)
+	defer httpSrv.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	publish := func(cl *Client, a int) (string, error) {
+		resp := make(map[string]string)
+		err := cl.SignedPost(context.Background(), "/v1/pubsub/topic/publish", auth.PubsubMsg, auth.Create, &testPayload{A: a}, &resp)
+		return resp["message_id"], err
+	}
+
+	// Record the interactions with the server
+	recorder, err := NewRecorder(path, RecorderConfig{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(recorder.Recording(), qt.IsTrue)
+
+	cfg := newTestClient(httpSrv.URL, RetryPolicy{MaxAttempts: 1}).cfg
+	cfg.Transport = recorder
+	msgID, err := publish(New(cfg), 1)
+	c.Assert(err, qt.IsNil)
+	c.Assert(msgID, qt.Equals, "msg-1")
+	c.Assert(recorder.Save(), qt.IsNil)
+
+	data, err := os.ReadFile(path)
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(data), qt.Contains, `"Authorization": [`+"\n"+`            "REDACTED"`)
+	c.Assert(strings.Contains(string(data), "ENCORE1-HMAC"), qt.IsFalse, qt.Commentf("signature should be redacted"))
+	c.Assert(string(data), qt.Contains, `"body": "{\"a\":1}"`)
+
+	// Replay them in a later run without the server, when the signatures have a different timestamp
+	httpSrv.Close()
+	replayCfg := func(keys ...auth.Key) *Config {
+		mockClock := clock.NewMock()
+		mockClock.Set(time.Now().Add(24 * time.Hour))
+		recorder, err := NewRecorder(path, RecorderConfig{AuthKeys: keys})
+		c.Assert(err, qt.IsNil)
+		c.Assert(recorder.Recording(), qt.IsFalse)
+
+		cfg := newTestClient(httpSrv.URL, RetryPolicy{MaxAttempts: 1}).cfg
+		cfg.Clock = mockClock
+		cfg.Transport = recorder
+		return cfg
+	}
+
+	cl := New(replayCfg(testKey))
+	msgID, err = publish(cl, 1)
+	c.Assert(err, qt.IsNil)
+	c.Assert(msgID, qt.Equals, "msg-1")
+
+	// Each interaction is only replayed once
+	_, err = publish(cl, 1)
+	c.Assert(err, qt.ErrorMatches, `failed to make request: .*no recorded interaction in .* matches POST /v1/pubsub/topic/publish`)
+
+	// Requests with a different body don't match
+	_, err = publish(New(replayCfg(testKey)), 2)
+	c.Assert(err, qt.ErrorMatches, `failed to make request: .*no recorded interaction .*`)
+
+	// Requests signed with the wrong key are rejected
+	_, err = publish(New(replayCfg(auth.Key{KeyID: 1, Data: []byte("other-key-data")})), 1)
+	c.Assert(err, qt.ErrorMatches, `failed to make request: .*replayed request is not validly signed: .*`)
+
+	// Replaying a missing cassette fails
+	_, err = NewRecorder(filepath.Join(t.TempDir(), "missing.json"), RecorderConfig{Mode: Replay})
+	c.Assert(err, qt.ErrorMatches, "failed to read cassette: .*")
+}
+
+func TestCanonicalBody(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "sorts keys", body: `{"b": 1, "a": {"d": [1, 2], "c": null}}`, want: `{"a":{"c":null,"d":[1,2]},"b":1}`},
+		{name: "keeps numbers exact", body: `{"n": 12345678901234567890}`, want: `{"n":12345678901234567890}`},
+		{name: "not json", body: `hello world`, want: `hello world`},
+		{name: "multiple values", body: `{} {}`, want: `{} {}`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			qt.Assert(t, string(canonicalBody([]byte(tt.body))), qt.Equals, tt.want)
+		})
+	}
+}
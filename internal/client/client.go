@@ -4,77 +4,304 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"time"
+
+	"github.com/benbjohnson/clock"
 
 	"go.encore.dev/platform-sdk/pkg/auth"
+	"go.encore.dev/platform-sdk/pkg/logging"
 )
 
 // Client is the underlying raw client for communicating with the Encore Platform services.
 //
 // It is injected into each service struct by the main [platform] package.
 type Client struct {
-	cfg *Config
+	cfg        *Config
+	httpClient *http.Client
+	invoke     Invoker
+	closers    []func() // called by Close to stop background work
 }
 
 func New(cfg *Config) *Client {
-	return &Client{cfg}
+	c := &Client{cfg: cfg, httpClient: &http.Client{Transport: cfg.Transport}}
+
+	// The configured interceptors wrap the built-in ones, so they see each call once
+	// no matter how many attempts are made to complete it
+	interceptors := make([]Interceptor, 0, len(cfg.Interceptors)+8)
+	if cfg.TracerProvider != nil {
+		interceptors = append(interceptors, TracingInterceptor(c.Tracer()))
+	}
+	if cfg.Metrics != nil {
+		interceptors = append(interceptors, MetricsInterceptor(cfg.Metrics, cfg.Clock.Now))
+	}
+	interceptors = append(interceptors, cfg.Interceptors...)
+	if cfg.CircuitBreaker != nil {
+		breaker := *cfg.CircuitBreaker
+		onStateChange := breaker.OnStateChange
+		breaker.OnStateChange = func(op OperationKey, from, to CircuitState) {
+			c.Logger().Warn("Encore Platform circuit breaker changed state", "operation", op.String(), "from", from.String(), "to", to.String())
+			if onStateChange != nil {
+				onStateChange(op, from, to)
+			}
+		}
+		interceptors = append(interceptors, CircuitBreakerInterceptor(breaker, cfg.Clock))
+	}
+	interceptors = append(interceptors, RetryInterceptor(cfg.Retry, cfg.Clock))
+	if cfg.RateLimit != nil {
+		// The rate limit is applied to each attempt, so retries can't exceed it
+		interceptors = append(interceptors, RateLimitInterceptor(*cfg.RateLimit, cfg.Clock))
+	}
+	if cfg.Failover != nil {
+		failover := *cfg.Failover
+		onFailover := failover.OnFailover
+		failover.OnFailover = func(from, to string, err error) {
+			c.Logger().Warn("failing over to another Encore Platform endpoint", "from", from, "to", to, "error", err)
+			if onFailover != nil {
+				onFailover(from, to, err)
+			}
+		}
+		endpoints := newEndpointSet(failover, cfg.Clock)
+		// Health checks aren't interactions with the platform's API, so they bypass a recorder
+		healthTransport := cfg.Transport
+		if recorder, ok := healthTransport.(*Recorder); ok {
+			healthTransport = recorder.cfg.Transport
+		}
+		endpoints.httpClient = &http.Client{Transport: healthTransport}
+		interceptors = append(interceptors, endpoints.intercept)
+		c.closers = append(c.closers, endpoints.close)
+	}
+	interceptors = append(interceptors, CompressionInterceptor(cfg.Compression))
+	if cfg.Logger != nil {
+		// Trace the requests as they are sent, after all the other interceptors have modified them
+		interceptors = append(interceptors, traceRequests(cfg.Logger, cfg.Clock))
+	}
+	c.invoke = chainInterceptors(interceptors, c.send)
+
+	return c
+}
+
+// Close stops any background work started by the client, such as the health checks
+// of failover endpoints. The client can still be used to make requests once closed.
+func (c *Client) Close() {
+	for _, closer := range c.closers {
+		closer()
+	}
+}
+
+// Clock returns the clock the client is configured to use.
+func (c *Client) Clock() clock.Clock {
+	return c.cfg.Clock
+}
+
+// Logger returns the logger the client is configured to log to.
+func (c *Client) Logger() logging.Logger {
+	if c.cfg.Logger == nil {
+		return logging.Discard{}
+	}
+	return c.cfg.Logger
+}
+
+// SigningKeyID returns the ID of the auth key new requests are signed with.
+func (c *Client) SigningKeyID() uint32 {
+	return c.cfg.LatestAuthKey.KeyID
 }
 
 // SignedPost performs a signed POST request to the specified path.
+//
+// It is a shorthand for [Client.Do] with a JSON encoded body and response.
 func (c *Client) SignedPost(ctx context.Context, path string, object auth.ObjectType, action auth.ActionType, body auth.Payload, response any, additionalAuthContext ...[]byte) error {
+	return c.Do(ctx, SignedRequest{
+		Method:                http.MethodPost,
+		Path:                  path,
+		Object:                object,
+		Action:                action,
+		AdditionalAuthContext: additionalAuthContext,
+		Payload:               body,
+		Response:              response,
+	})
+}
+
+// Do performs the given signed request.
+//
+// The request is passed through the configured [Interceptor] chain before being sent,
+// which by default retries requests failing with a transient error according to the
+// configured [RetryPolicy]. All attempts share the same [IdempotencyKeyHeader] so the
+// Encore Platform can deduplicate them.
+func (c *Client) Do(ctx context.Context, r SignedRequest) error {
+	method, err := r.method()
+	if err != nil {
+		return err
+	}
+
+	// Read a raw body into memory, so that it can be signed, compressed and retried
+	var rawBody []byte
+	if r.Body != nil {
+		rawBody, err = io.ReadAll(r.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read request body: %w", err)
+		}
+	}
+
 	// Hash the request
-	opHash, err := auth.NewOperationHash(
-		object, action, body, additionalAuthContext...,
+	opHash, err := r.opHash(rawBody)
+	if err != nil {
+		return err
+	}
+
+	// Create the request body
+	var (
+		body        io.Reader
+		contentType string
 	)
+	switch {
+	case r.Body != nil:
+		contentType = r.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		body = bytes.NewReader(rawBody)
+
+	case r.Payload != nil:
+		contentType = "application/json"
+		bodyBytes, err := json.Marshal(r.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request body: %w", err)
+		}
+		body = bytes.NewReader(bodyBytes)
+	}
+
+	req, err := c.newSignedRequest(ctx, method, &r, opHash, body, contentType)
 	if err != nil {
-		return fmt.Errorf("failed to hash request: %w", err)
+		return err
 	}
 
-	// Sign the hash
-	headers := auth.Sign(&c.cfg.LatestAuthKey, c.cfg.AppSlug, c.cfg.EnvName, c.cfg.Clock, opHash)
+	// Send the request
+	op := &Operation{Object: r.Object, Action: r.Action, Path: r.Path, PathTemplate: r.PathTemplate, hash: opHash, clock: c.cfg.Clock}
+	if op.PathTemplate == "" {
+		op.PathTemplate = r.Path
+	}
+	resp, err := c.invoke(ctx, op, req)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	} else if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// Decode the response
+	switch {
+	case r.Decode != nil:
+		if err := r.Decode(resp); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+
+	case r.Response != nil && resp.StatusCode != http.StatusNoContent:
+		if err := json.NewDecoder(resp.Body).Decode(r.Response); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
 
+	return nil
+}
+
+// newSignedRequest creates a new signed request.
+func (c *Client) newSignedRequest(ctx context.Context, method string, r *SignedRequest, opHash auth.OperationHash, body io.Reader, contentType string) (*http.Request, error) {
 	// Create the request
-	bodyBytes, err := json.Marshal(body)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request body: %w", err)
+	reqURL := fmt.Sprintf("%s%s", c.cfg.Host, r.Path)
+	if len(r.Query) > 0 {
+		reqURL += "?" + r.Query.Encode()
 	}
-	req, err := http.NewRequestWithContext(
-		ctx, http.MethodPost, fmt.Sprintf("%s%s", c.cfg.Host, path), bytes.NewReader(bodyBytes),
-	)
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, body)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set the headers
+	for key, values := range r.Header {
+		req.Header[key] = append([]string(nil), values...)
+	}
 	req.Header.Set("User-Agent", "Encore-Platform-SDK")
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/json")
+	}
 	req.Header.Set("Cache-Control", "no-cache")
 	req.Header.Set("Connection", "keep-alive")
+	req.Header.Set(IdempotencyKeyHeader, newIdempotencyKey())
+	c.sign(req, opHash)
+
+	return req, nil
+}
+
+// sign sets the authorization headers on the request for the given operation hash.
+func (c *Client) sign(req *http.Request, opHash auth.OperationHash) {
+	headers := auth.Sign(&c.cfg.LatestAuthKey, c.cfg.AppSlug, c.cfg.EnvName, c.cfg.Clock, opHash)
 	req.Header.Set("Authorization", headers.Authorization)
 	req.Header.Set("Date", headers.Date)
+}
 
-	// Send the request
-	resp, err := http.DefaultClient.Do(req)
+type probeKey struct{}
+
+// WithProbe returns a context for requests which probe the state of the Encore Platform, such as
+// connectivity checks. They bypass the circuit breaker and client-side rate limit, so they report
+// the state of the platform rather than of the client, and the time of the response according to
+// its Date header is stored in serverDate, whether or not the request succeeds.
+func WithProbe(ctx context.Context, serverDate *time.Time) context.Context {
+	return context.WithValue(ctx, probeKey{}, serverDate)
+}
+
+// isProbe reports whether the request was made with a context from [WithProbe].
+func isProbe(ctx context.Context) bool {
+	_, ok := ctx.Value(probeKey{}).(*time.Time)
+	return ok
+}
+
+// send is the final [Invoker] in the interceptor chain, which signs the request again
+// (as it may have been delayed or retried by the interceptors) and sends it.
+func (c *Client) send(ctx context.Context, op *Operation, req *http.Request) (*http.Response, error) {
+	c.sign(req, op.hash)
+
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to make request: %w", err)
+		return nil, err // nolint: wrapcheck
 	}
-	defer func() { _ = resp.Body.Close() }()
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected response status %s", resp.Status)
+
+	if serverDate, ok := ctx.Value(probeKey{}).(*time.Time); ok && serverDate != nil {
+		*serverDate, _ = http.ParseTime(resp.Header.Get("Date"))
 	}
 
-	// Decode the response
-	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
-		return fmt.Errorf("failed to decode response: %w", err)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer func() { _ = resp.Body.Close() }()
+		return nil, newAPIError(resp, c.cfg.Clock)
 	}
 
-	return nil
+	return resp, nil
 }
 
+// DefaultMaxRequestBodySize is the maximum size of a request body received from the Encore Platform
+// once decompressed, unless configured otherwise.
+const DefaultMaxRequestBodySize = 32 << 20
+
+// ErrRequestBodyTooLarge is returned by [Client.VerifyAndDecodeRequest] when the request body
+// exceeds the maximum request body size once decompressed.
+var ErrRequestBodyTooLarge = errors.New("request body too large")
+
 // VerifyAndDecodeRequest verifies the authenticity of the request and decodes the request into body.
+//
+// If the request body has been compressed using a supported Content-Encoding it is decompressed
+// before being decoded, as the operation hash is always computed over the uncompressed payload.
+// If the encoding is not supported an error wrapping [ErrUnsupportedEncoding] is returned.
+//
+// At most [Config.MaxRequestBodySize] bytes of the decompressed body are read, so that a small
+// compressed body can't exhaust memory. If it is larger an error wrapping [ErrRequestBodyTooLarge]
+// is returned.
 func (c *Client) VerifyAndDecodeRequest(req *http.Request, object auth.ObjectType, action auth.ActionType, body auth.Payload, additionalAuthContext ...[]byte) error {
 	opHash, err := auth.GetVerifiedOperationHash(req, c.cfg.AuthKeys, c.cfg.Clock)
 	if err != nil {
@@ -82,10 +309,22 @@ func (c *Client) VerifyAndDecodeRequest(req *http.Request, object auth.ObjectTyp
 	}
 
 	// Body bytes
-	bodyBytes, err := io.ReadAll(req.Body)
+	reqBody, err := Decompress(req.Header.Get("Content-Encoding"), req.Body)
+	if err != nil {
+		return fmt.Errorf("unable to decompress request body: %w", err)
+	}
+	defer func() { _ = reqBody.Close() }()
+	maxSize := c.cfg.MaxRequestBodySize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxRequestBodySize
+	}
+	bodyBytes, err := io.ReadAll(io.LimitReader(reqBody, maxSize+1))
 	if err != nil {
 		return fmt.Errorf("unable to read request body: %w", err)
 	}
+	if int64(len(bodyBytes)) > maxSize {
+		return fmt.Errorf("%w: exceeds %d bytes", ErrRequestBodyTooLarge, maxSize)
+	}
 
 	// Decode the payload
 	if err := json.Unmarshal(bodyBytes, body); err != nil {
@@ -0,0 +1,575 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	qt "github.com/frankban/quicktest"
+
+	"go.encore.dev/platform-sdk/pkg/auth"
+)
+
+var testKey = auth.Key{KeyID: 1, Data: []byte("test-key-data")} // nolint: gochecknoglobals
+
+type testPayload struct {
+	A       int    `json:"a"`
+	Padding string `json:"padding,omitempty"`
+}
+
+func (p *testPayload) DeterministicBytes() []byte {
+	b, _ := json.Marshal(p)
+	return b
+}
+
+func newTestClient(host string, retry RetryPolicy) *Client {
+	return New(&Config{
+		Host:          host,
+		Clock:         clock.New(),
+		AppSlug:       "test-app",
+		EnvName:       "test-env",
+		LatestAuthKey: testKey,
+		AuthKeys:      []auth.Key{testKey},
+		Retry:         retry,
+	})
+}
+
+// testServer records the requests it receives and responds with the given status codes in order,
+// after which it responds with 200 OK.
+type testServer struct {
+	mu              sync.Mutex
+	statuses        []int
+	headers         http.Header
+	idempotencyKeys []string
+	opHashes        []auth.OperationHash
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	opHash, err := auth.GetVerifiedOperationHash(req, []auth.Key{testKey}, clock.New())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	s.opHashes = append(s.opHashes, opHash)
+	s.idempotencyKeys = append(s.idempotencyKeys, req.Header.Get(IdempotencyKeyHeader))
+
+	if len(s.statuses) > 0 {
+		status := s.statuses[0]
+		s.statuses = s.statuses[1:]
+		for k, v := range s.headers {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(status)
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]string{"message_id": "msg-1"})
+}
+
+func TestSignedPost_Retries(t *testing.T) {
+	t.Parallel()
+
+	fastRetries := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2, Jitter: 0.5}
+
+	tests := []struct {
+		name         string
+		statuses     []int
+		headers      http.Header
+		retry        RetryPolicy
+		wantErr      string
+		wantAttempts int
+	}{
+		{name: "success", wantAttempts: 1, retry: fastRetries},
+		{name: "bad gateway then success", statuses: []int{http.StatusBadGateway}, wantAttempts: 2, retry: fastRetries},
+		{name: "throttled with retry after", statuses: []int{http.StatusTooManyRequests}, headers: http.Header{"Retry-After": {"0"}}, wantAttempts: 2, retry: fastRetries},
+		{name: "not retryable", statuses: []int{http.StatusBadRequest}, wantAttempts: 1, retry: fastRetries, wantErr: "unexpected response status 400 Bad Request"},
+		{name: "gives up", statuses: []int{500, 502, 503}, wantAttempts: 3, retry: fastRetries, wantErr: "unexpected response status 503 Service Unavailable"},
+		{name: "retries disabled", statuses: []int{http.StatusBadGateway}, wantAttempts: 1, wantErr: "unexpected response status 502 Bad Gateway"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := qt.New(t)
+
+			srv := &testServer{statuses: tt.statuses, headers: tt.headers}
+			httpSrv := httptest.NewServer(srv)
+			defer httpSrv.Close()
+
+			resp := make(map[string]string)
+			err := newTestClient(httpSrv.URL, tt.retry).SignedPost(
+				context.Background(), "/test", auth.PubsubMsg, auth.Create,
+				auth.BytesPayload(`{"hello":"world"}`), &resp,
+			)
+			if tt.wantErr != "" {
+				c.Assert(err, qt.ErrorMatches, ".*"+tt.wantErr)
+			} else {
+				c.Assert(err, qt.IsNil)
+				c.Assert(resp["message_id"], qt.Equals, "msg-1")
+			}
+
+			srv.mu.Lock()
+			defer srv.mu.Unlock()
+			c.Assert(srv.idempotencyKeys, qt.HasLen, tt.wantAttempts)
+			for i := range srv.idempotencyKeys {
+				c.Assert(srv.idempotencyKeys[i], qt.Not(qt.Equals), "", qt.Commentf("idempotency key should be set"))
+				c.Assert(srv.idempotencyKeys[i], qt.Equals, srv.idempotencyKeys[0], qt.Commentf("idempotency key should be the same across attempts"))
+				c.Assert(srv.opHashes[i], qt.Equals, srv.opHashes[0], qt.Commentf("op hash should be the same across attempts"))
+			}
+		})
+	}
+}
+
+func TestSignedPost_APIError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		status        int
+		body          string
+		header        http.Header
+		wantErr       *APIError
+		wantRetryable bool
+	}{
+		{
+			name:    "json error",
+			status:  http.StatusNotFound,
+			body:    `{"code": "not_found", "message": "topic not found"}`,
+			header:  http.Header{RequestIDHeader: {"req-123"}},
+			wantErr: &APIError{StatusCode: http.StatusNotFound, Code: "not_found", Message: "topic not found", RequestID: "req-123"},
+		},
+		{
+			name:    "plain text error",
+			status:  http.StatusUnauthorized,
+			body:    "authentication failed\n",
+			wantErr: &APIError{StatusCode: http.StatusUnauthorized, Message: "authentication failed"},
+		},
+		{
+			name:          "throttled",
+			status:        http.StatusTooManyRequests,
+			header:        http.Header{"Retry-After": {"3"}},
+			wantErr:       &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: 3 * time.Second},
+			wantRetryable: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := qt.New(t)
+
+			httpSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				for k, v := range tt.header {
+					w.Header()[k] = v
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer httpSrv.Close()
+
+			err := newTestClient(httpSrv.URL, RetryPolicy{}).SignedPost(
+				context.Background(), "/test", auth.PubsubMsg, auth.Create,
+				auth.BytesPayload(`{}`), &struct{}{},
+			)
+
+			var apiErr *APIError
+			c.Assert(errors.As(err, &apiErr), qt.IsTrue, qt.Commentf("expected an APIError, got %v", err))
+			c.Assert(apiErr, qt.DeepEquals, tt.wantErr)
+			c.Assert(apiErr.Retryable(), qt.Equals, tt.wantRetryable)
+		})
+	}
+}
+
+func TestDo(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		req        SignedRequest
+		wantMethod string
+		wantBody   string
+		wantQuery  string
+		wantHash   []byte // additional context expected in the op hash
+	}{
+		{
+			name:       "read with query",
+			req:        SignedRequest{Path: "/items", Object: auth.PubsubMsg, Action: auth.Read, Query: url.Values{"b": {"2"}, "a": {"1"}}},
+			wantMethod: http.MethodGet,
+			wantQuery:  "a=1&b=2",
+			wantHash:   []byte("a=1&b=2"),
+		},
+		{
+			name:       "update with payload",
+			req:        SignedRequest{Path: "/items/1", Object: auth.PubsubMsg, Action: auth.Update, Payload: &testPayload{A: 1}},
+			wantMethod: http.MethodPut,
+			wantBody:   `{"a":1}`,
+		},
+		{
+			name:       "delete",
+			req:        SignedRequest{Path: "/items/1", Object: auth.PubsubMsg, Action: auth.Delete},
+			wantMethod: http.MethodDelete,
+		},
+		{
+			name:       "raw body with explicit method",
+			req:        SignedRequest{Method: http.MethodPatch, Path: "/items/1", Object: auth.PubsubMsg, Action: auth.Update, Body: strings.NewReader("raw data"), ContentType: "text/plain"},
+			wantMethod: http.MethodPatch,
+			wantBody:   "raw data",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := qt.New(t)
+
+			httpSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				c.Check(req.Method, qt.Equals, tt.wantMethod)
+				c.Check(req.URL.RawQuery, qt.Equals, tt.wantQuery)
+
+				body, err := io.ReadAll(req.Body)
+				c.Check(err, qt.IsNil)
+				c.Check(string(body), qt.Equals, tt.wantBody)
+				c.Check(req.ContentLength, qt.Equals, int64(len(tt.wantBody)), qt.Commentf("the body should not be sent chunked"))
+
+				opHash, err := auth.GetVerifiedOperationHash(req, []auth.Key{testKey}, clock.New())
+				c.Check(err, qt.IsNil)
+
+				var additional [][]byte
+				if tt.wantHash != nil {
+					additional = append(additional, tt.wantHash)
+				}
+				payload := tt.req.Payload
+				if tt.req.Body != nil {
+					// A raw body is authenticated by its digest
+					payload = auth.WithBodyDigest(payload, body)
+				}
+				ok, err := opHash.Verify(tt.req.Object, tt.req.Action, payload, additional...)
+				c.Check(err, qt.IsNil)
+				c.Check(ok, qt.IsTrue, qt.Commentf("op hash did not verify"))
+
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer httpSrv.Close()
+
+			var resp struct{}
+			tt.req.Response = &resp
+			err := newTestClient(httpSrv.URL, RetryPolicy{}).Do(context.Background(), tt.req)
+			c.Assert(err, qt.IsNil)
+		})
+	}
+}
+
+func TestDo_StreamingResponse(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	httpSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		flusher, _ := w.(http.Flusher)
+		for i := 0; i < 3; i++ {
+			_, _ = fmt.Fprintf(w, "line %d\n", i)
+			flusher.Flush()
+		}
+	}))
+	defer httpSrv.Close()
+
+	var lines []string
+	err := newTestClient(httpSrv.URL, RetryPolicy{}).Do(context.Background(), SignedRequest{
+		Path:   "/stream",
+		Object: auth.PubsubMsg,
+		Action: auth.Read,
+		Decode: func(resp *http.Response) error {
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				lines = append(lines, scanner.Text())
+			}
+			return scanner.Err()
+		},
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(lines, qt.DeepEquals, []string{"line 0", "line 1", "line 2"})
+}
+
+func TestInterceptors(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	srv := &testServer{statuses: []int{http.StatusServiceUnavailable}}
+	httpSrv := httptest.NewServer(srv)
+	defer httpSrv.Close()
+
+	var calls []string
+	recorder := func(name string) Interceptor {
+		return func(ctx context.Context, op *Operation, req *http.Request, next Invoker) (*http.Response, error) {
+			calls = append(calls, name+" "+string(op.Action)+" "+op.Path)
+			req.Header.Set("X-"+name, "true")
+			return next(ctx, op, req)
+		}
+	}
+
+	cfg := newTestClient(httpSrv.URL, RetryPolicy{MaxAttempts: 2}).cfg
+	cfg.Interceptors = []Interceptor{recorder("first"), recorder("second")}
+	cl := New(cfg)
+
+	resp := make(map[string]string)
+	err := cl.SignedPost(context.Background(), "/test", auth.PubsubMsg, auth.Create, &testPayload{}, &resp)
+	c.Assert(err, qt.IsNil)
+	c.Assert(calls, qt.DeepEquals, []string{"first create /test", "second create /test"}, qt.Commentf("interceptors should wrap the retries"))
+
+	srv.mu.Lock()
+	c.Assert(srv.opHashes, qt.HasLen, 2)
+	srv.mu.Unlock()
+
+	// An interceptor can short-circuit the request
+	cfg.Interceptors = []Interceptor{func(ctx context.Context, op *Operation, req *http.Request, next Invoker) (*http.Response, error) {
+		return nil, &APIError{StatusCode: http.StatusTeapot}
+	}}
+	err = New(cfg).SignedPost(context.Background(), "/test", auth.PubsubMsg, auth.Create, &testPayload{}, &resp)
+	c.Assert(err, qt.ErrorMatches, "unexpected response status 418 I'm a teapot")
+
+	srv.mu.Lock()
+	c.Assert(srv.opHashes, qt.HasLen, 2, qt.Commentf("short-circuited request should not reach the server"))
+	srv.mu.Unlock()
+}
+
+// recordingLogger records every message logged to it.
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (l *recordingLogger) log(level, msg string, args []any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, strings.TrimSuffix(fmt.Sprintln(append([]any{level, msg}, args...)...), "\n"))
+}
+
+func (l *recordingLogger) Debug(msg string, args ...any) { l.log("DEBUG", msg, args) }
+func (l *recordingLogger) Info(msg string, args ...any)  { l.log("INFO", msg, args) }
+func (l *recordingLogger) Warn(msg string, args ...any)  { l.log("WARN", msg, args) }
+func (l *recordingLogger) Error(msg string, args ...any) { l.log("ERROR", msg, args) }
+
+func TestLogging(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	srv := &testServer{statuses: []int{http.StatusServiceUnavailable}}
+	httpSrv := httptest.NewServer(srv)
+	defer httpSrv.Close()
+
+	logger := &recordingLogger{}
+	cfg := newTestClient(httpSrv.URL, RetryPolicy{MaxAttempts: 2}).cfg
+	cfg.Logger = logger
+
+	resp := make(map[string]string)
+	err := New(cfg).SignedPost(context.Background(), "/test", auth.PubsubMsg, auth.Create, &testPayload{A: 1, Padding: "sensitive"}, &resp)
+	c.Assert(err, qt.IsNil)
+
+	// Every attempt is traced at debug level
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	c.Assert(logger.entries, qt.HasLen, 2)
+	for i, wantStatus := range []string{"status 503", "status 200"} {
+		entry := logger.entries[i]
+		c.Assert(entry, qt.Contains, "DEBUG sent Encore Platform request")
+		c.Assert(entry, qt.Contains, "object pubsub-msg action create method POST path /test "+wantStatus)
+	}
+
+	// Without including any secrets
+	for _, entry := range logger.entries {
+		c.Assert(strings.Contains(entry, "sensitive"), qt.IsFalse, qt.Commentf("payload logged: %s", entry))
+		c.Assert(strings.Contains(entry, string(testKey.Data)), qt.IsFalse, qt.Commentf("key logged: %s", entry))
+		c.Assert(strings.Contains(entry, "ENCORE1-HMAC"), qt.IsFalse, qt.Commentf("signature logged: %s", entry))
+	}
+}
+
+func TestLoggingInterceptor(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	httpSrv := httptest.NewServer(&testServer{})
+	defer httpSrv.Close()
+
+	// The duration is measured with the client's clock
+	mockClock := clock.NewMock()
+	mockClock.Set(time.Now())
+	logger := &recordingLogger{}
+	cfg := newTestClient(httpSrv.URL, RetryPolicy{MaxAttempts: 1}).cfg
+	cfg.Clock = mockClock
+	cfg.Interceptors = []Interceptor{
+		LoggingInterceptor(logger),
+		func(ctx context.Context, op *Operation, req *http.Request, next Invoker) (*http.Response, error) {
+			mockClock.Add(3 * time.Second)
+			return next(ctx, op, req)
+		},
+	}
+
+	resp := make(map[string]string)
+	err := New(cfg).SignedPost(context.Background(), "/test", auth.PubsubMsg, auth.Create, &testPayload{A: 1}, &resp)
+	c.Assert(err, qt.IsNil)
+
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	c.Assert(logger.entries, qt.HasLen, 1)
+	c.Assert(logger.entries[0], qt.Contains, "DEBUG Encore Platform request")
+	c.Assert(logger.entries[0], qt.Contains, "duration 3s")
+}
+
+func TestVerifyAndDecodeRequest_MaxBodySize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		padding int
+		wantErr string
+	}{
+		{name: "within limit", padding: 100},
+		{name: "exceeds limit", padding: 4096, wantErr: "request body too large: exceeds 1024 bytes"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := qt.New(t)
+
+			cl := newTestClient("http://localhost", RetryPolicy{})
+			cl.cfg.MaxRequestBodySize = 1024
+
+			// The compressed body is tiny however large it is once decompressed
+			payload := &testPayload{A: 1, Padding: strings.Repeat("a", tt.padding)}
+			data, err := json.Marshal(payload)
+			c.Assert(err, qt.IsNil)
+			compressed, err := Compress(GzipCompression, data)
+			c.Assert(err, qt.IsNil)
+			c.Assert(len(compressed) < 1024, qt.IsTrue)
+
+			opHash, err := auth.NewOperationHash(auth.PubsubMsg, auth.Read, payload)
+			c.Assert(err, qt.IsNil)
+			headers := auth.Sign(&testKey, "test-app", "test-env", clock.New(), opHash)
+			req := httptest.NewRequest(http.MethodPost, "/push", bytes.NewReader(compressed))
+			req.Header.Set("Authorization", headers.Authorization)
+			req.Header.Set("Date", headers.Date)
+			req.Header.Set("Content-Encoding", string(GzipCompression))
+
+			err = cl.VerifyAndDecodeRequest(req, auth.PubsubMsg, auth.Read, &testPayload{})
+			if tt.wantErr != "" {
+				c.Assert(err, qt.ErrorMatches, tt.wantErr)
+				c.Assert(errors.Is(err, ErrRequestBodyTooLarge), qt.IsTrue)
+			} else {
+				c.Assert(err, qt.IsNil)
+			}
+		})
+	}
+}
+
+func TestCompression(t *testing.T) {
+	t.Parallel()
+
+	for _, compression := range []Compression{GzipCompression, ZstdCompression} {
+		compression := compression
+		t.Run(string(compression), func(t *testing.T) {
+			t.Parallel()
+			c := qt.New(t)
+
+			var (
+				mu        sync.Mutex
+				encodings []string
+				reject    bool
+			)
+			httpSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				encoding := req.Header.Get("Content-Encoding")
+				encodings = append(encodings, encoding)
+				if reject && encoding != "" {
+					w.WriteHeader(http.StatusUnsupportedMediaType)
+					return
+				}
+
+				// Verify the signature is over the uncompressed payload
+				body, err := Decompress(encoding, req.Body)
+				c.Check(err, qt.IsNil)
+				payload := &testPayload{}
+				c.Check(json.NewDecoder(body).Decode(payload), qt.IsNil)
+				opHash, err := auth.GetVerifiedOperationHash(req, []auth.Key{testKey}, clock.New())
+				c.Check(err, qt.IsNil)
+				ok, err := opHash.Verify(auth.PubsubMsg, auth.Create, payload)
+				c.Check(err, qt.IsNil)
+				c.Check(ok, qt.IsTrue)
+
+				// Respond with a compressed body
+				c.Check(req.Header.Get("Accept-Encoding"), qt.Equals, AcceptedEncodings)
+				resp, err := Compress(compression, []byte(`{"message_id": "msg-1"}`))
+				c.Check(err, qt.IsNil)
+				if !reject {
+					w.Header().Set("Accept-Encoding", string(compression))
+				}
+				w.Header().Set("Content-Encoding", string(compression))
+				_, _ = w.Write(resp)
+			}))
+			defer httpSrv.Close()
+
+			cl := newTestClient(httpSrv.URL, RetryPolicy{})
+			cl.cfg.Compression = compression
+			cl = New(cl.cfg)
+
+			publish := func(payload *testPayload) {
+				resp := make(map[string]string)
+				err := cl.SignedPost(context.Background(), "/test", auth.PubsubMsg, auth.Create, payload, &resp)
+				c.Assert(err, qt.IsNil)
+				c.Assert(resp["message_id"], qt.Equals, "msg-1")
+			}
+
+			// The first request is not compressed, as the server hasn't advertised support yet
+			publish(&testPayload{A: 1, Padding: strings.Repeat("a", 2*minCompressionSize)})
+			// Small requests are never compressed
+			publish(&testPayload{A: 2})
+			// Large requests are compressed once the server has advertised support
+			publish(&testPayload{A: 3, Padding: strings.Repeat("a", 2*minCompressionSize)})
+
+			// If the server stops accepting compressed requests, we fall back to uncompressed requests
+			mu.Lock()
+			reject = true
+			mu.Unlock()
+			publish(&testPayload{A: 4, Padding: strings.Repeat("a", 2*minCompressionSize)})
+			publish(&testPayload{A: 5, Padding: strings.Repeat("a", 2*minCompressionSize)})
+
+			mu.Lock()
+			defer mu.Unlock()
+			c.Assert(encodings, qt.DeepEquals, []string{"", "", string(compression), string(compression), "", ""})
+		})
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}
+	c.Assert(policy.Backoff(0), qt.Equals, time.Duration(0))
+	c.Assert(policy.Backoff(1), qt.Equals, 100*time.Millisecond)
+	c.Assert(policy.Backoff(2), qt.Equals, 200*time.Millisecond)
+	c.Assert(policy.Backoff(3), qt.Equals, 400*time.Millisecond)
+	c.Assert(policy.Backoff(10), qt.Equals, time.Second)
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		backoff := policy.Backoff(2)
+		c.Assert(backoff >= 100*time.Millisecond && backoff <= 200*time.Millisecond, qt.IsTrue, qt.Commentf("backoff %s out of range", backoff))
+	}
+}
@@ -0,0 +1,213 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is a content encoding used to compress request and response bodies.
+type Compression string
+
+const (
+	NoCompression   Compression = ""     // Bodies are sent uncompressed
+	GzipCompression Compression = "gzip" // Bodies are compressed using gzip
+	ZstdCompression Compression = "zstd" // Bodies are compressed using Zstandard
+)
+
+// AcceptedEncodings is the value of the Accept-Encoding header the SDK sends to advertise
+// the content encodings it can decode, in order of preference.
+const AcceptedEncodings = "zstd, gzip"
+
+// minCompressionSize is the minimum size of a body before it is compressed,
+// as compressing smaller bodies is not worth the overhead.
+const minCompressionSize = 1024
+
+// Compress compresses data using the given compression.
+func Compress(compression Compression, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	var w io.WriteCloser
+	switch compression {
+	case GzipCompression:
+		w = gzip.NewWriter(&buf)
+	case ZstdCompression:
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd writer: %w", err)
+		}
+		w = zw
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", compression)
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to compress data: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress data: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress returns a reader which decompresses r, which was compressed using
+// the given content encoding. If the encoding is empty or "identity" r is returned as is.
+func Decompress(contentEncoding string, r io.ReadCloser) (io.ReadCloser, error) {
+	switch Compression(strings.ToLower(strings.TrimSpace(contentEncoding))) {
+	case NoCompression, "identity":
+		return r, nil
+
+	case GzipCompression:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+		}
+		return &decompressingReader{Reader: gr, closers: []func() error{gr.Close, r.Close}}, nil
+
+	case ZstdCompression:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd reader: %w", err)
+		}
+		return &decompressingReader{Reader: zr, closers: []func() error{func() error { zr.Close(); return nil }, r.Close}}, nil
+
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedEncoding, contentEncoding)
+	}
+}
+
+// ErrUnsupportedEncoding is returned by [Decompress] when the content encoding is not supported.
+var ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// decompressingReader reads decompressed data and closes both the
+// decompressor and the underlying reader when closed.
+type decompressingReader struct {
+	io.Reader
+	closers []func() error
+}
+
+func (d *decompressingReader) Close() error {
+	var firstErr error
+	for _, closer := range d.closers {
+		if err := closer(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header values include the compression.
+func acceptsEncoding(values []string, compression Compression) bool {
+	for _, value := range values {
+		for _, encoding := range strings.Split(value, ",") {
+			// Ignore any quality value given
+			encoding, _, _ = strings.Cut(encoding, ";")
+			if Compression(strings.ToLower(strings.TrimSpace(encoding))) == compression {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CompressionInterceptor returns an [Interceptor] which negotiates compressed request
+// and response bodies with the Encore Platform.
+//
+// Every request advertises the encodings the SDK can decode using the Accept-Encoding header,
+// and compressed responses are transparently decompressed. If compression is set, request
+// bodies are compressed once the platform has advertised support for it using an Accept-Encoding
+// response header. If the platform later rejects a compressed request with 415 Unsupported
+// Media Type, the request is sent again uncompressed and compression is disabled until
+// the platform advertises support for it again.
+//
+// Compression only changes how the body is sent over the wire, the operation hash is always
+// computed over the canonical uncompressed payload.
+func CompressionInterceptor(compression Compression) Interceptor {
+	var serverAccepts atomic.Bool
+
+	return func(ctx context.Context, op *Operation, req *http.Request, next Invoker) (*http.Response, error) {
+		req.Header.Set("Accept-Encoding", AcceptedEncodings)
+
+		original, compressed := req, false
+		if compression != NoCompression && serverAccepts.Load() && req.GetBody != nil && req.ContentLength >= minCompressionSize {
+			compressedReq, err := compressRequest(ctx, req, compression)
+			if err != nil {
+				return nil, err
+			}
+			req, compressed = compressedReq, true
+		}
+
+		resp, err := next(ctx, op, req)
+
+		var apiErr *APIError
+		if compressed && errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnsupportedMediaType {
+			serverAccepts.Store(false)
+
+			body, bodyErr := original.GetBody()
+			if bodyErr != nil {
+				return nil, fmt.Errorf("failed to rewind request body: %w", bodyErr)
+			}
+			req = original.Clone(ctx)
+			req.Body = body
+			resp, err = next(ctx, op, req)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if compression != NoCompression && acceptsEncoding(resp.Header.Values("Accept-Encoding"), compression) {
+			serverAccepts.Store(true)
+		}
+
+		if encoding := resp.Header.Get("Content-Encoding"); encoding != "" {
+			body, err := Decompress(encoding, resp.Body)
+			if err != nil {
+				_ = resp.Body.Close()
+				return nil, err
+			}
+			resp.Body = body
+			resp.Header.Del("Content-Encoding")
+			resp.Header.Del("Content-Length")
+			resp.ContentLength = -1
+			resp.Uncompressed = true
+		}
+
+		return resp, nil
+	}
+}
+
+// compressRequest returns a clone of req with its body compressed,
+// leaving the body of req untouched.
+func compressRequest(ctx context.Context, req *http.Request, compression Compression) (*http.Request, error) {
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	defer func() { _ = body.Close() }()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	compressedData, err := Compress(compression, data)
+	if err != nil {
+		return nil, err
+	}
+
+	compressedReq := req.Clone(ctx)
+	compressedReq.Body = io.NopCloser(bytes.NewReader(compressedData))
+	compressedReq.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(compressedData)), nil
+	}
+	compressedReq.ContentLength = int64(len(compressedData))
+	compressedReq.Header.Set("Content-Encoding", string(compression))
+	return compressedReq, nil
+}
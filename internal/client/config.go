@@ -1,16 +1,105 @@
 package client
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
 	"github.com/benbjohnson/clock"
 	"go.encore.dev/platform-sdk/pkg/auth"
+	"go.encore.dev/platform-sdk/pkg/logging"
+	"go.encore.dev/platform-sdk/pkg/metrics"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Config is the configuration for the client.
 type Config struct {
-	Host          string      // The host to use
-	Clock         clock.Clock // The clock to use
-	AppSlug       string      // The app slug to use
-	EnvName       string      // The environment name to use
-	LatestAuthKey auth.Key    // The auth key to use when signing new requests
-	AuthKeys      []auth.Key  // All known auth keys (used to verify data sent from the Encore Platform services)
+	Host           string                // The host to use
+	Clock          clock.Clock           // The clock to use
+	AppSlug        string                // The app slug to use
+	EnvName        string                // The environment name to use
+	LatestAuthKey  auth.Key              // The auth key to use when signing new requests
+	AuthKeys       []auth.Key            // All known auth keys (used to verify data sent from the Encore Platform services)
+	Retry          RetryPolicy           // The policy for retrying failed requests
+	Interceptors   []Interceptor         // Interceptors to call for every request, the first being the outermost
+	TracerProvider trace.TracerProvider  // The OpenTelemetry tracer provider to record spans with (tracing is disabled if nil)
+	Metrics        metrics.Metrics       // The metrics to record observations to (metrics are disabled if nil)
+	Compression    Compression           // The compression to use for request bodies once the platform supports it
+	CircuitBreaker *CircuitBreakerConfig // The circuit breaker configuration (circuit breaking is disabled if nil)
+	RateLimit      *RateLimitConfig      // The client-side rate limits (rate limiting is disabled if nil)
+	Failover       *FailoverConfig       // The endpoints to fail over between (if nil, all requests are sent to Host)
+	Logger         logging.Logger        // The logger to log to (logging is disabled if nil)
+	Transport      http.RoundTripper     // The transport to send requests with (defaults to http.DefaultTransport)
+
+	// MaxRequestBodySize is the maximum size of a request body received from the Encore Platform
+	// once decompressed (defaults to [DefaultMaxRequestBodySize])
+	MaxRequestBodySize int64
+}
+
+// Validate checks the configuration is complete and consistent, returning
+// an error describing every problem found.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Host == "" {
+		errs = append(errs, errors.New("no host configured"))
+	} else if err := validateHost(c.Host); err != nil {
+		errs = append(errs, fmt.Errorf("invalid host %q: %w", c.Host, err))
+	}
+
+	if c.Failover != nil {
+		if len(c.Failover.Endpoints) == 0 {
+			errs = append(errs, errors.New("no failover endpoints configured"))
+		}
+		for _, endpoint := range c.Failover.Endpoints {
+			if err := validateHost(endpoint); err != nil {
+				errs = append(errs, fmt.Errorf("invalid failover endpoint %q: %w", endpoint, err))
+			}
+		}
+	}
+
+	if c.AppSlug == "" {
+		errs = append(errs, errors.New("no app slug configured"))
+	}
+	if c.EnvName == "" {
+		errs = append(errs, errors.New("no environment name configured"))
+	}
+
+	if c.LatestAuthKey.KeyID == 0 || len(c.LatestAuthKey.Data) == 0 {
+		errs = append(errs, errors.New("no signing key configured"))
+	}
+	keysByID := make(map[uint32][]byte, len(c.AuthKeys))
+	for _, key := range c.AuthKeys {
+		if len(key.Data) == 0 {
+			errs = append(errs, fmt.Errorf("auth key %d has no data", key.KeyID))
+			continue
+		}
+		if existing, found := keysByID[key.KeyID]; found && !bytes.Equal(existing, key.Data) {
+			errs = append(errs, fmt.Errorf("auth key %d configured multiple times with different data", key.KeyID))
+		}
+		keysByID[key.KeyID] = key.Data
+	}
+
+	if c.Clock == nil {
+		errs = append(errs, errors.New("no clock configured"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateHost checks host is the base URL of an Encore Platform endpoint.
+func validateHost(host string) error {
+	u, err := url.Parse(host)
+	switch {
+	case err != nil:
+		return err // nolint: wrapcheck
+	case (u.Scheme != "http" && u.Scheme != "https") || u.Host == "":
+		return errors.New("must be an absolute http or https URL")
+	case u.RawQuery != "" || u.Fragment != "":
+		return errors.New("must not contain a query or fragment")
+	default:
+		return nil
+	}
 }
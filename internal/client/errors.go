@@ -0,0 +1,93 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+// RequestIDHeader is the header the Encore Platform uses to identify a request,
+// which can be given to Encore support when investigating a failure.
+const RequestIDHeader = "X-Request-ID"
+
+// maxErrorBodySize is the maximum number of bytes read from an error response body.
+const maxErrorBodySize = 64 * 1024
+
+// APIError is returned when the Encore Platform responds to a request with
+// a non-200 status code.
+//
+// It can be extracted from errors returned by the SDK using [errors.As].
+type APIError struct {
+	StatusCode int           // The HTTP status code of the response
+	Code       string        // The error code returned by the platform (if any)
+	Message    string        // The error message returned by the platform (if any)
+	RequestID  string        // The ID the platform assigned to the request (if any)
+	RetryAfter time.Duration // The delay requested by the platform before retrying (if any)
+}
+
+func (e *APIError) Error() string {
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "unexpected response status %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+
+	switch {
+	case e.Code != "" && e.Message != "":
+		_, _ = fmt.Fprintf(&b, ": %s: %s", e.Code, e.Message)
+	case e.Message != "":
+		_, _ = fmt.Fprintf(&b, ": %s", e.Message)
+	case e.Code != "":
+		_, _ = fmt.Fprintf(&b, ": %s", e.Code)
+	}
+
+	if e.RequestID != "" {
+		_, _ = fmt.Fprintf(&b, " (request id: %s)", e.RequestID)
+	}
+	return b.String()
+}
+
+// Retryable reports whether the request may succeed if it is retried,
+// which is the case if the platform is throttling requests or failed
+// with a server side error.
+func (e *APIError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+// newAPIError creates an [APIError] from the response, consuming the response body.
+//
+// The body is decoded as a JSON error document in the format written by the jsonerr
+// package, if the body is not in that format its text is used as the message.
+func newAPIError(resp *http.Response, clock clock.Clock) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get(RequestIDHeader),
+	}
+	apiErr.RetryAfter, _ = retryAfter(resp, clock)
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return apiErr
+	}
+
+	var doc struct {
+		Code      string `json:"code"`
+		Message   string `json:"message"`
+		RequestID string `json:"request_id"`
+	}
+	if err := json.Unmarshal(body, &doc); err == nil {
+		apiErr.Code = doc.Code
+		apiErr.Message = doc.Message
+		if apiErr.RequestID == "" {
+			apiErr.RequestID = doc.RequestID
+		}
+	} else {
+		apiErr.Message = string(body)
+	}
+
+	return apiErr
+}
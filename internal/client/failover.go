@@ -0,0 +1,315 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+// FailoverConfig configures the client to send requests to one of several
+// Encore Platform endpoints, failing over between them.
+//
+// Requests are sent to the healthy endpoint with the lowest latency, as measured by periodic
+// health checks, with endpoints of equal latency preferred in the order they are given. If an
+// endpoint fails a request with a network error or a 5xx response it is marked unhealthy and
+// the request is immediately sent to the next endpoint, until an endpoint succeeds or all have
+// failed. Unhealthy endpoints are only used again once a health check has succeeded, unless
+// all endpoints are unhealthy in which case they are all tried in order.
+//
+// Health checks are only made if HealthCheckPath is set. Without them, endpoints are preferred
+// in the order they are given, and an endpoint which failed a request is used again once
+// HealthCheckInterval has passed.
+//
+// Requests are signed the same way whichever endpoint they are sent to.
+type FailoverConfig struct {
+	Endpoints           []string      // The URLs of the endpoints, in order of preference
+	HealthCheckPath     string        // The path requested to check the health of an endpoint (health checks are disabled if empty)
+	HealthCheckInterval time.Duration // How often the endpoints are health checked, or failed endpoints retried without health checks (defaults to 30s)
+	HealthCheckTimeout  time.Duration // How long a health check may take before the endpoint is unhealthy (defaults to 5s)
+
+	// OnFailover is called whenever a request fails over from one endpoint to another
+	// because of the given error. It is called synchronously while the request is being
+	// processed, so it should not block.
+	OnFailover func(from, to string, err error)
+
+	// OnHealthChange is called whenever an endpoint becomes healthy or unhealthy.
+	// It should not block.
+	OnHealthChange func(endpoint string, healthy bool)
+}
+
+func (cfg FailoverConfig) withDefaults() FailoverConfig {
+	if cfg.HealthCheckInterval <= 0 {
+		cfg.HealthCheckInterval = 30 * time.Second
+	}
+	if cfg.HealthCheckTimeout <= 0 {
+		cfg.HealthCheckTimeout = 5 * time.Second
+	}
+	return cfg
+}
+
+// isFailoverError reports whether a request which failed with err should
+// be sent to another endpoint.
+func isFailoverError(ctx context.Context, err error) bool {
+	var apiErr *APIError
+	switch {
+	case err == nil || ctx.Err() != nil:
+		return false
+	case errors.As(err, &apiErr):
+		return apiErr.StatusCode >= http.StatusInternalServerError
+	default:
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+}
+
+// endpoint is the state of a single failover endpoint.
+type endpoint struct {
+	url      string
+	index    int           // the position of the endpoint in the configuration
+	healthy  bool          // whether the endpoint is healthy
+	failedAt time.Time     // when the endpoint last became unhealthy
+	latency  time.Duration // the latency of the last successful health check
+}
+
+// endpointSet tracks the health of the failover endpoints.
+type endpointSet struct {
+	cfg        FailoverConfig
+	clock      clock.Clock
+	httpClient *http.Client
+	check      func(ctx context.Context, endpoint string) error
+
+	// Background health checks run until the client is closed
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+
+	mu        sync.Mutex
+	endpoints []*endpoint
+	lastCheck time.Time // when the endpoints were last health checked
+	checking  bool      // whether a health check is in progress
+}
+
+func newEndpointSet(cfg FailoverConfig, clock clock.Clock) *endpointSet {
+	s := &endpointSet{cfg: cfg.withDefaults(), clock: clock, httpClient: http.DefaultClient}
+	s.check = s.healthCheck
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	for i, url := range cfg.Endpoints {
+		s.endpoints = append(s.endpoints, &endpoint{url: url, index: i, healthy: true})
+	}
+	return s
+}
+
+// FailoverInterceptor returns an [Interceptor] which sends requests to one of the
+// configured endpoints, failing over between them as described by [FailoverConfig].
+//
+// Health checks run in the background until the returned stop function is called.
+func FailoverInterceptor(cfg FailoverConfig, clock clock.Clock) (interceptor Interceptor, stop func()) {
+	s := newEndpointSet(cfg, clock)
+	return s.intercept, s.close
+}
+
+// close stops the background health checks, waiting for any in progress to return.
+func (s *endpointSet) close() {
+	s.cancel()
+	s.running.Wait()
+}
+
+func (s *endpointSet) intercept(ctx context.Context, op *Operation, req *http.Request, next Invoker) (*http.Response, error) {
+	s.maybeCheckHealth()
+
+	candidates := s.candidates()
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		// The body can only be sent once
+		candidates = candidates[:1]
+	}
+
+	var lastErr error
+	for i, endpoint := range candidates {
+		attemptReq, err := s.requestFor(ctx, req, op, endpoint, i > 0)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := next(ctx, op, attemptReq)
+		if !isFailoverError(ctx, err) {
+			return resp, err
+		}
+		lastErr = err
+
+		s.setHealthy(endpoint, false)
+		if i+1 < len(candidates) && s.cfg.OnFailover != nil {
+			s.cfg.OnFailover(endpoint, candidates[i+1], err)
+		}
+	}
+	return nil, lastErr
+}
+
+// requestFor returns a copy of req to be sent to the given endpoint.
+func (s *endpointSet) requestFor(ctx context.Context, req *http.Request, op *Operation, endpoint string, rewind bool) (*http.Request, error) {
+	u, err := url.Parse(endpoint + op.Path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint %q: %w", endpoint, err)
+	}
+	u.RawQuery = req.URL.RawQuery
+
+	endpointReq := req.Clone(ctx)
+	endpointReq.URL = u
+	endpointReq.Host = u.Host
+	if rewind && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("failed to rewind request body: %w", err)
+		}
+		endpointReq.Body = body
+	}
+	return endpointReq, nil
+}
+
+// candidates returns the endpoints to try in order, the healthy endpoints ordered by
+// latency followed by the unhealthy endpoints in order of preference.
+func (s *endpointSet) candidates() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ordered := append([]*endpoint(nil), s.endpoints...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		if a.healthy != b.healthy {
+			return a.healthy
+		}
+		if a.healthy && a.latency != b.latency {
+			return a.latency < b.latency
+		}
+		return a.index < b.index
+	})
+
+	urls := make([]string, len(ordered))
+	for i, e := range ordered {
+		urls[i] = e.url
+	}
+	return urls
+}
+
+// setHealthy records whether the endpoint with the given URL is healthy.
+func (s *endpointSet) setHealthy(url string, healthy bool) {
+	s.mu.Lock()
+	var changed bool
+	for _, e := range s.endpoints {
+		if e.url == url && e.healthy != healthy {
+			e.healthy, changed = healthy, true
+			if !healthy {
+				e.failedAt = s.clock.Now()
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	if changed && s.cfg.OnHealthChange != nil {
+		s.cfg.OnHealthChange(url, healthy)
+	}
+}
+
+// maybeCheckHealth starts health checking the endpoints in the background
+// if they have not been checked within the health check interval. If health
+// checks are disabled, it marks the endpoints which failed more than the
+// interval ago as healthy again instead.
+func (s *endpointSet) maybeCheckHealth() {
+	if s.cfg.HealthCheckPath == "" {
+		s.recoverFailed()
+		return
+	}
+
+	s.mu.Lock()
+	due := !s.checking && s.ctx.Err() == nil && (s.lastCheck.IsZero() || s.clock.Since(s.lastCheck) >= s.cfg.HealthCheckInterval)
+	if due {
+		s.checking = true
+		s.running.Add(1)
+	}
+	s.mu.Unlock()
+
+	if due {
+		go func() {
+			defer s.running.Done()
+			s.checkHealth(s.ctx)
+		}()
+	}
+}
+
+// recoverFailed marks the endpoints which became unhealthy more than the health check interval ago as healthy.
+func (s *endpointSet) recoverFailed() {
+	var recovered []string
+	s.mu.Lock()
+	for _, e := range s.endpoints {
+		if !e.healthy && s.clock.Since(e.failedAt) >= s.cfg.HealthCheckInterval {
+			recovered = append(recovered, e.url)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, url := range recovered {
+		s.setHealthy(url, true)
+	}
+}
+
+// checkHealth health checks all the endpoints concurrently and waits for the checks to complete.
+func (s *endpointSet) checkHealth(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, e := range s.endpoints {
+		url := e.url
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, s.cfg.HealthCheckTimeout)
+			defer cancel()
+
+			start := s.clock.Now()
+			err := s.check(ctx, url)
+			latency := s.clock.Since(start)
+
+			s.setHealthy(url, err == nil)
+			if err == nil {
+				s.mu.Lock()
+				for _, e := range s.endpoints {
+					if e.url == url {
+						e.latency = latency
+					}
+				}
+				s.mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	s.lastCheck = s.clock.Now()
+	s.checking = false
+	s.mu.Unlock()
+}
+
+// healthCheck is the default health check, which requires the health check
+// path of the endpoint to respond with a 2xx status code.
+func (s *endpointSet) healthCheck(ctx context.Context, endpoint string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+s.cfg.HealthCheckPath, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create health check request: %w", err)
+	}
+	req.Header.Set("User-Agent", "Encore-Platform-SDK")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err // nolint: wrapcheck
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("health check failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	qt "github.com/frankban/quicktest"
+
+	"go.encore.dev/platform-sdk/pkg/auth"
+)
+
+// testHealthCheckPath is the health check path of test endpoints.
+const testHealthCheckPath = "/health"
+
+// testEndpoint is a local Encore Platform endpoint whose health, latency and
+// responses can be changed while a test is running.
+type testEndpoint struct {
+	*httptest.Server
+	delay    time.Duration
+	status   atomic.Int32 // the status to respond with, 0 meaning 200 OK
+	received atomic.Int32 // the number of API requests received
+	checks   atomic.Int32 // the number of health checks received
+}
+
+func newTestEndpoint(t *testing.T, delay time.Duration) *testEndpoint {
+	e := &testEndpoint{delay: delay}
+	e.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(e.delay)
+		if status := int(e.status.Load()); status != 0 {
+			w.WriteHeader(status)
+			return
+		}
+		if req.URL.Path == testHealthCheckPath {
+			e.checks.Add(1)
+			return
+		}
+
+		e.received.Add(1)
+		if _, err := auth.GetVerifiedOperationHash(req, []auth.Key{testKey}, clock.New()); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		var payload testPayload
+		if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"endpoint": e.URL})
+	}))
+	t.Cleanup(e.Close)
+	return e
+}
+
+func TestFailover(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	slow := newTestEndpoint(t, 50*time.Millisecond)
+	fast := newTestEndpoint(t, 0)
+	down := newTestEndpoint(t, 0)
+	down.status.Store(http.StatusServiceUnavailable)
+	closed := newTestEndpoint(t, 0)
+	closed.Close()
+
+	var mu sync.Mutex
+	var failovers []string
+	set := newEndpointSet(FailoverConfig{
+		Endpoints:       []string{slow.URL, closed.URL, down.URL, fast.URL},
+		HealthCheckPath: testHealthCheckPath,
+		OnFailover: func(from, to string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failovers = append(failovers, from+" -> "+to)
+		},
+	}, clock.New())
+
+	client := newTestClient("", RetryPolicy{MaxAttempts: 1})
+	invoke := chainInterceptors([]Interceptor{set.intercept}, client.send)
+	call := func() (string, error) {
+		var resp struct{ Endpoint string }
+		client := &Client{cfg: client.cfg, invoke: invoke}
+		err := client.SignedPost(context.Background(), "/v1/test", auth.PubsubMsg, auth.Create, &testPayload{A: 1}, &resp)
+		return resp.Endpoint, err
+	}
+
+	// Before the endpoints have been checked, they're used in order of preference,
+	// failing over on connection errors and 5xx responses
+	set.checking = true
+	set.setHealthy(fast.URL, false)
+	endpoint, err := call()
+	c.Assert(err, qt.IsNil)
+	c.Assert(endpoint, qt.Equals, slow.URL)
+
+	slow.status.Store(http.StatusBadGateway)
+	endpoint, err = call()
+	c.Assert(err, qt.IsNil)
+	c.Assert(endpoint, qt.Equals, fast.URL)
+	c.Assert(failovers, qt.DeepEquals, []string{
+		slow.URL + " -> " + closed.URL,
+		closed.URL + " -> " + down.URL,
+		down.URL + " -> " + fast.URL,
+	})
+
+	// Once checked, the healthy endpoint with the lowest latency is preferred
+	slow.status.Store(0)
+	set.checkHealth(context.Background())
+	c.Assert(set.candidates(), qt.DeepEquals, []string{fast.URL, slow.URL, closed.URL, down.URL})
+
+	failovers = nil
+	fast.status.Store(http.StatusInternalServerError)
+	endpoint, err = call()
+	c.Assert(err, qt.IsNil)
+	c.Assert(endpoint, qt.Equals, slow.URL)
+	c.Assert(failovers, qt.DeepEquals, []string{fast.URL + " -> " + slow.URL})
+
+	// The failed endpoint isn't used again until it passes a health check
+	fast.status.Store(0)
+	fast.received.Store(0)
+	endpoint, err = call()
+	c.Assert(err, qt.IsNil)
+	c.Assert(endpoint, qt.Equals, slow.URL)
+	c.Assert(fast.received.Load(), qt.Equals, int32(0))
+
+	set.checkHealth(context.Background())
+	endpoint, err = call()
+	c.Assert(err, qt.IsNil)
+	c.Assert(endpoint, qt.Equals, fast.URL)
+
+	// Client errors don't fail over
+	failovers = nil
+	fast.status.Store(http.StatusBadRequest)
+	_, err = call()
+	var apiErr *APIError
+	c.Assert(errors.As(err, &apiErr), qt.IsTrue)
+	c.Assert(apiErr.StatusCode, qt.Equals, http.StatusBadRequest)
+	c.Assert(failovers, qt.HasLen, 0)
+
+	// When every endpoint fails, the last error is returned
+	for _, e := range []*testEndpoint{slow, down, fast} {
+		e.status.Store(http.StatusServiceUnavailable)
+	}
+	_, err = call()
+	c.Assert(errors.As(err, &apiErr), qt.IsTrue)
+	c.Assert(apiErr.StatusCode, qt.Equals, http.StatusServiceUnavailable)
+}
+
+func TestFailover_HealthCheckInterval(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	mockClock := clock.NewMock()
+	var checks atomic.Int32
+	set := newEndpointSet(FailoverConfig{Endpoints: []string{"http://a", "http://b"}, HealthCheckPath: testHealthCheckPath, HealthCheckInterval: time.Minute}, mockClock)
+	defer set.close()
+	set.check = func(ctx context.Context, endpoint string) error {
+		checks.Add(1)
+		if endpoint == "http://a" {
+			return errors.New("unhealthy")
+		}
+		return nil
+	}
+
+	next := func(ctx context.Context, op *Operation, req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Request: req}, nil
+	}
+	call := func() string {
+		req, _ := http.NewRequest(http.MethodGet, "http://ignored/v1/test", nil)
+		resp, err := set.intercept(context.Background(), &Operation{Path: "/v1/test"}, req, next)
+		c.Assert(err, qt.IsNil)
+		return resp.Request.URL.String()
+	}
+
+	// The first request starts the health checks in the background
+	c.Assert(call(), qt.Equals, "http://a/v1/test")
+	waitFor(c, func() bool { return checks.Load() == 2 && set.candidates()[0] == "http://b" })
+	c.Assert(call(), qt.Equals, "http://b/v1/test")
+
+	// They're not checked again until the interval has passed
+	mockClock.Add(30 * time.Second)
+	call()
+	mockClock.Add(30 * time.Second)
+	call()
+	waitFor(c, func() bool { return checks.Load() == 4 })
+}
+
+func TestFailover_WithoutHealthChecks(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	mockClock := clock.NewMock()
+	set := newEndpointSet(FailoverConfig{Endpoints: []string{"http://a", "http://b"}, HealthCheckInterval: time.Minute}, mockClock)
+	set.check = func(ctx context.Context, endpoint string) error {
+		c.Error("no health check should be made without a health check path")
+		return nil
+	}
+
+	var failing atomic.Bool
+	failing.Store(true)
+	next := func(ctx context.Context, op *Operation, req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "a" && failing.Load() {
+			return nil, &APIError{StatusCode: http.StatusBadGateway}
+		}
+		return &http.Response{StatusCode: http.StatusOK, Request: req}, nil
+	}
+	call := func() string {
+		req, _ := http.NewRequest(http.MethodGet, "http://ignored/v1/test", nil)
+		resp, err := set.intercept(context.Background(), &Operation{Path: "/v1/test"}, req, next)
+		c.Assert(err, qt.IsNil)
+		return resp.Request.URL.String()
+	}
+
+	// The failed endpoint is avoided until the interval has passed
+	c.Assert(call(), qt.Equals, "http://b/v1/test")
+	failing.Store(false)
+	mockClock.Add(30 * time.Second)
+	c.Assert(call(), qt.Equals, "http://b/v1/test")
+	mockClock.Add(30 * time.Second)
+	c.Assert(call(), qt.Equals, "http://a/v1/test")
+}
+
+func TestFailover_Close(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	set := newEndpointSet(FailoverConfig{Endpoints: []string{"http://a"}, HealthCheckPath: testHealthCheckPath}, clock.New())
+	started := make(chan struct{}, 1)
+	set.check = func(ctx context.Context, endpoint string) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	next := func(ctx context.Context, op *Operation, req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}
+	req, _ := http.NewRequest(http.MethodGet, "http://ignored/v1/test", nil)
+	_, err := set.intercept(context.Background(), &Operation{Path: "/v1/test"}, req, next)
+	c.Assert(err, qt.IsNil)
+	<-started
+
+	// Closing cancels the health check in progress and waits for it to return
+	set.close()
+	set.mu.Lock()
+	checking := set.checking
+	set.mu.Unlock()
+	c.Assert(checking, qt.IsFalse)
+
+	// No health checks are started once closed
+	set.mu.Lock()
+	set.lastCheck = time.Time{}
+	set.mu.Unlock()
+	_, err = set.intercept(context.Background(), &Operation{Path: "/v1/test"}, req, next)
+	c.Assert(err, qt.IsNil)
+	c.Assert(started, qt.HasLen, 0)
+}
+
+func TestFailover_HealthChecksBypassRecorder(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	endpoint := newTestEndpoint(t, 0)
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	recorder, err := NewRecorder(path, RecorderConfig{Mode: Record})
+	c.Assert(err, qt.IsNil)
+
+	cl := New(&Config{
+		Host:          endpoint.URL,
+		Clock:         clock.New(),
+		AppSlug:       "test-app",
+		EnvName:       "test-env",
+		LatestAuthKey: testKey,
+		AuthKeys:      []auth.Key{testKey},
+		Transport:     recorder,
+		Failover:      &FailoverConfig{Endpoints: []string{endpoint.URL}, HealthCheckPath: testHealthCheckPath},
+	})
+	defer cl.Close()
+
+	var resp struct{ Endpoint string }
+	c.Assert(cl.SignedPost(context.Background(), "/v1/test", auth.PubsubMsg, auth.Create, &testPayload{A: 1}, &resp), qt.IsNil)
+	waitFor(c, func() bool { return endpoint.checks.Load() == 1 })
+
+	c.Assert(recorder.Save(), qt.IsNil)
+	data, err := os.ReadFile(path)
+	c.Assert(err, qt.IsNil)
+	var cassette Cassette
+	c.Assert(json.Unmarshal(data, &cassette), qt.IsNil)
+	c.Assert(cassette.Interactions, qt.HasLen, 1, qt.Commentf("only the API request should be recorded"))
+	c.Assert(cassette.Interactions[0].Request.URL, qt.Equals, "/v1/test")
+}
+
+// waitFor waits for cond to become true, failing the test if it takes more than a few seconds.
+func waitFor(c *qt.C, cond func() bool) {
+	c.Helper()
+	for start := time.Now(); !cond(); time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			c.Fatal("timed out waiting for condition")
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/benbjohnson/clock"
+
+	"go.encore.dev/platform-sdk/pkg/auth"
+	"go.encore.dev/platform-sdk/pkg/logging"
+)
+
+// Operation describes the operation a request to the Encore Platform is performing.
+type Operation struct {
+	Object       auth.ObjectType // The object type being operated on
+	Action       auth.ActionType // The action being performed on the object
+	Path         string          // The path of the API being called
+	PathTemplate string          // The template of the path, with any identifiers replaced by placeholders
+
+	hash  auth.OperationHash // The operation hash the request is signed with
+	clock clock.Clock        // The clock of the client performing the operation
+}
+
+// Key returns the key identifying the operation independently of the
+// identifiers in its path.
+func (op *Operation) Key() OperationKey {
+	return OperationKey{Object: op.Object, Action: op.Action, PathTemplate: op.PathTemplate}
+}
+
+// Invoker sends a signed request to the Encore Platform.
+//
+// If the platform responds with a non-2xx status code, the invoker
+// returns an [*APIError] rather than the response.
+type Invoker func(ctx context.Context, op *Operation, req *http.Request) (*http.Response, error)
+
+// Interceptor intercepts requests made to the Encore Platform.
+//
+// An interceptor is given the operation being performed and the signed request, and
+// calls next to continue the chain. It may modify the request before calling next, observe
+// or replace the response or error returned by next, or short-circuit the chain by returning
+// without calling next at all.
+//
+// The request is signed again just before it is sent, so interceptors are free to delay or
+// repeat calls to next without the signature expiring.
+type Interceptor func(ctx context.Context, op *Operation, req *http.Request, next Invoker) (*http.Response, error)
+
+// chainInterceptors returns an [Invoker] which calls the interceptors in order,
+// with the first interceptor being the outermost, before calling final.
+func chainInterceptors(interceptors []Interceptor, final Invoker) Invoker {
+	invoker := final
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoker
+		invoker = func(ctx context.Context, op *Operation, req *http.Request) (*http.Response, error) {
+			return interceptor(ctx, op, req, next)
+		}
+	}
+	return invoker
+}
+
+// RetryInterceptor returns an [Interceptor] which retries requests that fail with a
+// transient error according to the given policy.
+//
+// Requests whose body cannot be replayed, or which are made with a context
+// returned by [WithoutRetries], are not retried.
+func RetryInterceptor(policy RetryPolicy, clock clock.Clock) Interceptor {
+	return func(ctx context.Context, op *Operation, req *http.Request, next Invoker) (*http.Response, error) {
+		maxAttempts := policy.MaxAttempts
+		if noRetries, _ := ctx.Value(withoutRetriesKey{}).(bool); noRetries {
+			maxAttempts = 1
+		}
+		if maxAttempts < 1 || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+			maxAttempts = 1
+		}
+
+		for attempt := 1; ; attempt++ {
+			attemptReq := req
+			if attempt > 1 && req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, fmt.Errorf("failed to rewind request body: %w", err)
+				}
+				attemptReq = req.Clone(ctx)
+				attemptReq.Body = body
+			}
+
+			resp, err := next(ctx, op, attemptReq)
+			if attempt >= maxAttempts || !shouldRetry(ctx, err) {
+				return resp, err
+			}
+
+			delay := policy.Backoff(attempt)
+			var apiErr *APIError
+			if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+				delay = apiErr.RetryAfter
+			}
+
+			if sleepErr := sleep(ctx, clock, delay); sleepErr != nil {
+				return nil, fmt.Errorf("gave up retrying request after %d attempts: %w", attempt, err)
+			}
+		}
+	}
+}
+
+// LoggingInterceptor returns an [Interceptor] which logs every request made
+// to the Encore Platform at debug level, and every failed request at warn level.
+func LoggingInterceptor(logger logging.Logger) Interceptor {
+	return func(ctx context.Context, op *Operation, req *http.Request, next Invoker) (*http.Response, error) {
+		clk := op.clock
+		if clk == nil {
+			clk = clock.New()
+		}
+		start := clk.Now()
+		resp, err := next(ctx, op, req)
+
+		args := requestLogArgs(op, req, resp, err)
+		args = append(args, "duration", clk.Since(start))
+		if err != nil {
+			logger.Warn("Encore Platform request failed", append(args, "error", err)...)
+		} else {
+			logger.Debug("Encore Platform request", args...)
+		}
+
+		return resp, err
+	}
+}
+
+// traceRequests returns an [Interceptor] which logs every attempt to send a request
+// to the Encore Platform at debug level.
+func traceRequests(logger logging.Logger, clock clock.Clock) Interceptor {
+	return func(ctx context.Context, op *Operation, req *http.Request, next Invoker) (*http.Response, error) {
+		start := clock.Now()
+		resp, err := next(ctx, op, req)
+
+		args := requestLogArgs(op, req, resp, err)
+		args = append(args, "host", req.URL.Host, "idempotency_key", req.Header.Get(IdempotencyKeyHeader), "duration", clock.Since(start))
+		if err != nil {
+			args = append(args, "error", err)
+		}
+		logger.Debug("sent Encore Platform request", args...)
+
+		return resp, err
+	}
+}
+
+// requestLogArgs returns the key values describing a request for logging.
+//
+// It deliberately excludes the request headers, query and body,
+// which may contain signatures or sensitive data.
+func requestLogArgs(op *Operation, req *http.Request, resp *http.Response, err error) []any {
+	args := []any{
+		"object", string(op.Object),
+		"action", string(op.Action),
+		"method", req.Method,
+		"path", op.Path,
+	}
+
+	var apiErr *APIError
+	switch {
+	case resp != nil:
+		args = append(args, "status", resp.StatusCode)
+		if requestID := resp.Header.Get(RequestIDHeader); requestID != "" {
+			args = append(args, "request_id", requestID)
+		}
+	case errors.As(err, &apiErr):
+		args = append(args, "status", apiErr.StatusCode)
+		if apiErr.RequestID != "" {
+			args = append(args, "request_id", apiErr.RequestID)
+		}
+	}
+	return args
+}
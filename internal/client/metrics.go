@@ -0,0 +1,54 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"go.encore.dev/platform-sdk/pkg/metrics"
+)
+
+// Metrics returns the metrics the client is configured to record to, which
+// discards all observations if no metrics have been configured.
+func (c *Client) Metrics() metrics.Metrics {
+	if c.cfg.Metrics == nil {
+		return metrics.Discard{}
+	}
+	return c.cfg.Metrics
+}
+
+// MetricsInterceptor returns an [Interceptor] which records the outcome
+// and duration of every request to the given metrics.
+func MetricsInterceptor(m metrics.Metrics, clock func() time.Time) Interceptor {
+	return func(ctx context.Context, op *Operation, req *http.Request, next Invoker) (*http.Response, error) {
+		start := clock()
+		resp, err := next(ctx, op, req)
+		m.ObserveRequest(string(op.Object), string(op.Action), OutcomeOf(err), clock().Sub(start))
+		return resp, err
+	}
+}
+
+// OutcomeOf returns the [metrics.Outcome] of an operation which returned the given error.
+func OutcomeOf(err error) metrics.Outcome {
+	var apiErr *APIError
+	switch {
+	case err == nil:
+		return metrics.Success
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return metrics.Cancelled
+	case errors.Is(err, ErrRateLimited):
+		return metrics.Throttled
+	case errors.As(err, &apiErr):
+		switch {
+		case apiErr.StatusCode == http.StatusTooManyRequests:
+			return metrics.Throttled
+		case apiErr.StatusCode >= http.StatusInternalServerError:
+			return metrics.ServerError
+		default:
+			return metrics.ClientError
+		}
+	default:
+		return metrics.NetworkError
+	}
+}
@@ -0,0 +1,255 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+// ErrRateLimited is returned when a request is not sent because it would exceed the
+// configured rate limit and the caller asked not to wait. The returned error is a
+// [*RateLimitedError].
+var ErrRateLimited = errors.New("rate limited")
+
+// RateLimitedError is the error returned when a request is not sent because of the rate limit.
+type RateLimitedError struct {
+	Operation OperationKey  // The operation which was rate limited
+	RetryIn   time.Duration // How long until the request would be allowed
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("%s: %s, retry in %s", ErrRateLimited, e.Operation, e.RetryIn)
+}
+
+func (e *RateLimitedError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// RateLimit is a token bucket rate limit.
+type RateLimit struct {
+	Rate  float64 // The number of requests allowed per second (zero means unlimited)
+	Burst int     // The number of requests allowed in a burst (defaults to 1)
+}
+
+// RateLimitConfig configures the client-side rate limits applied to requests.
+//
+// A request must be allowed by both the global limit and the limit of its operation (if any)
+// before it is sent. When the Encore Platform responds with 429 Too Many Requests the limit
+// is paused for the duration of any Retry-After header and its rate halved, after which it
+// recovers gradually as requests succeed.
+type RateLimitConfig struct {
+	Global     RateLimit                  // The limit applied to all requests
+	Operations map[OperationKey]RateLimit // The limits applied to specific operations
+
+	// NoWait makes requests which exceed the limit fail immediately with [ErrRateLimited]
+	// rather than waiting for the limit to allow them. It can be overridden for a single
+	// request using [WithRateLimitWait].
+	NoWait bool
+}
+
+type rateLimitWaitKey struct{}
+
+// WithRateLimitWait returns a context which overrides whether requests made with it wait
+// for the rate limit to allow them (wait = true), or fail immediately with [ErrRateLimited].
+func WithRateLimitWait(ctx context.Context, wait bool) context.Context {
+	return context.WithValue(ctx, rateLimitWaitKey{}, wait)
+}
+
+// RateLimitInterceptor returns an [Interceptor] which limits the rate of requests
+// sent to the Encore Platform.
+func RateLimitInterceptor(cfg RateLimitConfig, clock clock.Clock) Interceptor {
+	global := newTokenBucket(cfg.Global, clock)
+	operations := make(map[OperationKey]*tokenBucket, len(cfg.Operations))
+	for key, limit := range cfg.Operations {
+		operations[key] = newTokenBucket(limit, clock)
+	}
+
+	return func(ctx context.Context, op *Operation, req *http.Request, next Invoker) (*http.Response, error) {
+		if isProbe(ctx) {
+			return next(ctx, op, req)
+		}
+		wait := !cfg.NoWait
+		if override, ok := ctx.Value(rateLimitWaitKey{}).(bool); ok {
+			wait = override
+		}
+
+		buckets := []*tokenBucket{global}
+		if bucket, found := operations[op.Key()]; found {
+			buckets = append(buckets, bucket)
+		}
+
+		for i, bucket := range buckets {
+			if err := bucket.take(ctx, wait); err != nil {
+				// Return the tokens taken from the buckets which allowed the request
+				for _, taken := range buckets[:i] {
+					taken.giveBack()
+				}
+
+				var rateErr *RateLimitedError
+				if errors.As(err, &rateErr) {
+					rateErr.Operation = op.Key()
+				}
+				return nil, err
+			}
+		}
+
+		resp, err := next(ctx, op, req)
+
+		var apiErr *APIError
+		throttled := errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests
+		for _, bucket := range buckets {
+			if throttled {
+				bucket.throttled(apiErr.RetryAfter)
+			} else if err == nil {
+				bucket.succeeded()
+			}
+		}
+
+		return resp, err
+	}
+}
+
+const (
+	// defaultThrottlePause is how long a bucket is paused for when the platform
+	// throttles a request without sending a Retry-After header.
+	defaultThrottlePause = time.Second
+
+	// minRateFraction is the lowest fraction of the configured rate
+	// a bucket will reduce its rate to when throttled.
+	minRateFraction = 1.0 / 16
+
+	// recoveryFraction is the fraction of the configured rate a bucket
+	// recovers for each successful request after being throttled.
+	recoveryFraction = 1.0 / 20
+)
+
+// tokenBucket is an adaptive token bucket rate limiter.
+type tokenBucket struct {
+	limit RateLimit
+	clock clock.Clock
+
+	mu          sync.Mutex
+	rate        float64   // the current rate, which is reduced when throttled
+	tokens      float64   // the available tokens, negative when requests are waiting
+	last        time.Time // when the tokens were last refilled
+	pausedUntil time.Time // when the bucket was paused until due to throttling
+}
+
+func newTokenBucket(limit RateLimit, clock clock.Clock) *tokenBucket {
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return &tokenBucket{
+		limit:  limit,
+		clock:  clock,
+		rate:   limit.Rate,
+		tokens: float64(limit.Burst),
+		last:   clock.Now(),
+	}
+}
+
+// take takes a token from the bucket, waiting for one to become available if wait is true.
+func (b *tokenBucket) take(ctx context.Context, wait bool) error {
+	if b.limit.Rate <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	now := b.clock.Now()
+	b.refill(now)
+
+	var delay time.Duration
+	if b.pausedUntil.After(now) {
+		delay = b.pausedUntil.Sub(now)
+	}
+	if missing := 1 - b.tokens; missing > 0 {
+		delay += time.Duration(missing / b.rate * float64(time.Second))
+	}
+
+	if delay > 0 {
+		deadline, hasDeadline := ctx.Deadline()
+		if !wait || (hasDeadline && now.Add(delay).After(deadline)) {
+			b.mu.Unlock()
+			return &RateLimitedError{RetryIn: delay}
+		}
+	}
+
+	// Reserve the token, even if we have to wait for it
+	b.tokens--
+	b.mu.Unlock()
+
+	if err := sleep(ctx, b.clock, delay); err != nil {
+		b.giveBack()
+		return err
+	}
+	return nil
+}
+
+// giveBack returns a token taken for a request which was not sent.
+func (b *tokenBucket) giveBack() {
+	if b.limit.Rate <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.tokens+1, float64(b.limit.Burst))
+}
+
+// refill adds the tokens accumulated since the last refill, the caller must hold b.mu.
+func (b *tokenBucket) refill(now time.Time) {
+	if now.Before(b.pausedUntil) {
+		b.last = now
+		return
+	}
+
+	from := b.last
+	if from.Before(b.pausedUntil) {
+		from = b.pausedUntil
+	}
+	if elapsed := now.Sub(from); elapsed > 0 {
+		b.tokens = math.Min(b.tokens+elapsed.Seconds()*b.rate, float64(b.limit.Burst))
+	}
+	b.last = now
+}
+
+// throttled is called when the platform throttled a request.
+func (b *tokenBucket) throttled(retryAfter time.Duration) {
+	if b.limit.Rate <= 0 {
+		return
+	}
+	if retryAfter <= 0 {
+		retryAfter = defaultThrottlePause
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.clock.Now()
+	b.refill(now)
+	if until := now.Add(retryAfter); until.After(b.pausedUntil) {
+		b.pausedUntil = until
+	}
+	b.rate = math.Max(b.rate/2, b.limit.Rate*minRateFraction)
+}
+
+// succeeded is called when a request succeeded, allowing the rate to recover.
+func (b *tokenBucket) succeeded() {
+	if b.limit.Rate <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.rate < b.limit.Rate {
+		b.refill(b.clock.Now())
+		b.rate = math.Min(b.rate+b.limit.Rate*recoveryFraction, b.limit.Rate)
+	}
+}
@@ -0,0 +1,141 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	qt "github.com/frankban/quicktest"
+
+	"go.encore.dev/platform-sdk/pkg/auth"
+)
+
+func TestRateLimit(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	publish := &Operation{Object: auth.PubsubMsg, Action: auth.Create, Path: "/v1/pubsub/a/publish", PathTemplate: "/v1/pubsub/{topic}/publish"}
+	other := &Operation{Object: auth.PubsubMsg, Action: auth.Read, Path: "/v1/other", PathTemplate: "/v1/other"}
+
+	mockClock := clock.NewMock()
+	interceptor := RateLimitInterceptor(RateLimitConfig{
+		Global:     RateLimit{Rate: 10, Burst: 10},
+		Operations: map[OperationKey]RateLimit{publish.Key(): {Rate: 1, Burst: 2}},
+		NoWait:     true,
+	}, mockClock)
+
+	var nextErr error
+	next := func(ctx context.Context, op *Operation, req *http.Request) (*http.Response, error) {
+		if nextErr != nil {
+			return nil, nextErr
+		}
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}
+	call := func(ctx context.Context, op *Operation) error {
+		_, err := interceptor(ctx, op, &http.Request{}, next)
+		return err
+	}
+	assertLimited := func(err error, retryIn time.Duration) {
+		c.Helper()
+		var rateErr *RateLimitedError
+		c.Assert(errors.Is(err, ErrRateLimited), qt.IsTrue, qt.Commentf("expected rate limited error, got %v", err))
+		c.Assert(errors.As(err, &rateErr), qt.IsTrue)
+		c.Assert(rateErr.RetryIn, qt.Equals, retryIn)
+		c.Assert(rateErr.Operation, qt.Equals, publish.Key())
+	}
+
+	// The burst is allowed, then further requests are rejected
+	c.Assert(call(context.Background(), publish), qt.IsNil)
+	c.Assert(call(context.Background(), publish), qt.IsNil)
+	assertLimited(call(context.Background(), publish), time.Second)
+
+	// Probes bypass the limit
+	c.Assert(call(WithProbe(context.Background(), nil), publish), qt.IsNil)
+
+	// Other operations are only limited by the global limit
+	c.Assert(call(context.Background(), other), qt.IsNil)
+
+	// Tokens are refilled over time
+	mockClock.Add(time.Second)
+	c.Assert(call(context.Background(), publish), qt.IsNil)
+	assertLimited(call(context.Background(), publish), time.Second)
+
+	// When the platform throttles a request, the buckets pause for the Retry-After
+	// duration and then refill at half the rate
+	mockClock.Add(time.Second)
+	nextErr = &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: 5 * time.Second}
+	c.Assert(call(context.Background(), publish), qt.Equals, nextErr)
+	nextErr = nil
+	assertLimited(call(context.Background(), publish), 5*time.Second)
+	mockClock.Add(5 * time.Second)
+	assertLimited(call(context.Background(), publish), 2*time.Second)
+	mockClock.Add(2 * time.Second)
+	c.Assert(call(context.Background(), publish), qt.IsNil)
+
+	// A request can ask to wait for the limit, in which case it blocks until allowed,
+	// which takes longer than a second as the rate is still recovering
+	done := make(chan error, 1)
+	go func() { done <- call(WithRateLimitWait(context.Background(), true), publish) }()
+	for waited := time.Duration(0); ; waited += 100 * time.Millisecond {
+		select {
+		case err := <-done:
+			c.Assert(err, qt.IsNil)
+			c.Assert(waited > time.Second, qt.IsTrue, qt.Commentf("request should have waited, waited %s", waited))
+			return
+		default:
+			time.Sleep(time.Millisecond)
+			mockClock.Add(100 * time.Millisecond)
+		}
+	}
+}
+
+func TestRateLimit_ThroughClient(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	var sent atomic.Int32
+	httpSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		sent.Add(1)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer httpSrv.Close()
+
+	var transitions []string
+	cl := New(&Config{
+		Host:          httpSrv.URL,
+		Clock:         clock.New(),
+		AppSlug:       "test-app",
+		EnvName:       "test-env",
+		LatestAuthKey: testKey,
+		AuthKeys:      []auth.Key{testKey},
+		Retry:         DefaultRetryPolicy(),
+		RateLimit:     &RateLimitConfig{Global: RateLimit{Rate: 0.001, Burst: 1}, NoWait: true},
+		CircuitBreaker: &CircuitBreakerConfig{
+			FailureThreshold: 2,
+			OnStateChange: func(op OperationKey, from, to CircuitState) {
+				transitions = append(transitions, to.String())
+			},
+		},
+	})
+	publish := func() error {
+		return cl.SignedPost(context.Background(), "/test", auth.PubsubMsg, auth.Create, auth.BytesPayload(`{}`), &struct{}{})
+	}
+
+	c.Assert(publish(), qt.IsNil)
+
+	// Rejected requests fail immediately rather than being retried,
+	// and don't open the circuit breaker
+	for i := 0; i < 5; i++ {
+		start := time.Now()
+		err := publish()
+		c.Assert(errors.Is(err, ErrRateLimited), qt.IsTrue, qt.Commentf("expected rate limited error, got %v", err))
+		c.Assert(time.Since(start) < 50*time.Millisecond, qt.IsTrue, qt.Commentf("took %s", time.Since(start)))
+	}
+	c.Assert(sent.Load(), qt.Equals, int32(1))
+	c.Assert(transitions, qt.HasLen, 0)
+}
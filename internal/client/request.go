@@ -0,0 +1,91 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"go.encore.dev/platform-sdk/pkg/auth"
+)
+
+// ResponseDecoder decodes a successful response from the Encore Platform.
+//
+// The response body is streamed from the server while the decoder runs and
+// is closed once the decoder returns, so the decoder must not retain it.
+type ResponseDecoder func(resp *http.Response) error
+
+// SignedRequest describes a request to an Encore Platform API which will be signed
+// using the latest auth key of the client.
+type SignedRequest struct {
+	Method       string      // The HTTP method (if empty, it is derived from Action)
+	Path         string      // The path of the API to call
+	PathTemplate string      // The template of Path, such as "/v1/pubsub/{topic}/publish" (defaults to Path)
+	Query        url.Values  // Optional query parameters, these are included in the operation hash
+	Header       http.Header // Optional additional headers to send with the request
+
+	Object                auth.ObjectType // The object type being operated on
+	Action                auth.ActionType // The action being performed on the object
+	AdditionalAuthContext [][]byte        // Additional context to include in the operation hash
+
+	// Payload is the request payload. It is included in the operation hash and, unless
+	// Body is set, it is sent JSON encoded as the request body.
+	Payload auth.Payload
+
+	// Body is an optional raw request body, which is read into memory before the request is sent.
+	// When it is set the Payload is only used for the operation hash, which also covers a digest
+	// of the body so that it is authenticated (see [auth.WithBodyDigest]).
+	Body        io.Reader
+	ContentType string // The content type of Body (defaults to application/octet-stream)
+
+	// Response is decoded from the JSON response body if it is not nil and Decode is not set.
+	Response any
+
+	// Decode is an optional decoder for the response, which allows streaming responses
+	// to be processed as they are received. It takes precedence over Response.
+	Decode ResponseDecoder
+}
+
+// method returns the HTTP method for the request.
+func (r *SignedRequest) method() (string, error) {
+	if r.Method != "" {
+		return r.Method, nil
+	}
+	return MethodForAction(r.Action)
+}
+
+// opHash returns the operation hash for the request, given the raw body read from Body if it is set.
+func (r *SignedRequest) opHash(rawBody []byte) (auth.OperationHash, error) {
+	additionalContext := r.AdditionalAuthContext
+	if len(r.Query) > 0 {
+		// Encode sorts the query by key, which makes this deterministic
+		additionalContext = append(additionalContext[:len(additionalContext):len(additionalContext)], []byte(r.Query.Encode()))
+	}
+
+	payload := r.Payload
+	if r.Body != nil {
+		payload = auth.WithBodyDigest(payload, rawBody)
+	}
+
+	opHash, err := auth.NewOperationHash(r.Object, r.Action, payload, additionalContext...)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash request: %w", err)
+	}
+	return opHash, nil
+}
+
+// MethodForAction returns the HTTP method used for the given action.
+func MethodForAction(action auth.ActionType) (string, error) {
+	switch action {
+	case auth.Create:
+		return http.MethodPost, nil
+	case auth.Read:
+		return http.MethodGet, nil
+	case auth.Update:
+		return http.MethodPut, nil
+	case auth.Delete:
+		return http.MethodDelete, nil
+	default:
+		return "", fmt.Errorf("no HTTP method known for action %q", action)
+	}
+}
@@ -0,0 +1,156 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"math"
+	mathrand "math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+// IdempotencyKeyHeader is the header used to send a unique key for each logical request,
+// which is the same across all retry attempts of that request. This allows the Encore Platform
+// to deduplicate requests which were retried after the first attempt was processed.
+const IdempotencyKeyHeader = "X-Encore-Idempotency-Key"
+
+// RetryPolicy configures how the client retries requests which failed with a transient error.
+//
+// A request is retried if it fails with a network error, or the server responds with
+// a 429 Too Many Requests or a 5xx status code. If the server sends a Retry-After header
+// it will be used instead of the computed backoff.
+type RetryPolicy struct {
+	MaxAttempts    int           // The maximum number of attempts, including the first (values below 2 disable retries)
+	InitialBackoff time.Duration // The backoff before the first retry
+	MaxBackoff     time.Duration // The maximum backoff between two attempts
+	Multiplier     float64       // The multiplier applied to the backoff after each attempt
+	Jitter         float64       // The fraction of the backoff which is randomised, between 0 and 1
+}
+
+// DefaultRetryPolicy returns the retry policy used by the SDK if none is configured.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+type withoutRetriesKey struct{}
+
+// WithoutRetries returns a context which disables retries for requests made with it.
+func WithoutRetries(ctx context.Context) context.Context {
+	return context.WithValue(ctx, withoutRetriesKey{}, true)
+}
+
+// Backoff returns the time to wait before the given retry, where retry 1 is the
+// first retry after the initial attempt failed.
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	if retry < 1 || p.InitialBackoff <= 0 {
+		return 0
+	}
+
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	backoff := float64(p.InitialBackoff) * math.Pow(multiplier, float64(retry-1))
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+
+	// Apply the jitter, such that the backoff is in the range [backoff * (1 - jitter), backoff]
+	if jitter := math.Min(math.Max(p.Jitter, 0), 1); jitter > 0 {
+		backoff -= backoff * jitter * mathrand.Float64() // nolint: gosec
+	}
+
+	return time.Duration(backoff)
+}
+
+// shouldRetry reports whether an attempt which failed with the given error should be retried.
+func shouldRetry(ctx context.Context, err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Retryable()
+	}
+
+	// Requests rejected by the client-side rate limiter were asked not to wait,
+	// and an open circuit breaker would reject the retry just the same
+	if errors.Is(err, ErrRateLimited) || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+
+	// If our own context is done, there's no point retrying
+	return ctx.Err() == nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// retryAfter returns the delay requested by the server using the Retry-After header
+// which can either be a number of seconds or an HTTP date.
+func retryAfter(resp *http.Response, clock clock.Clock) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		delay := date.Sub(clock.Now())
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+
+	return 0, false
+}
+
+// sleep waits for the given duration using the clock, returning early
+// with the context error if the context is done first.
+func sleep(ctx context.Context, clock clock.Clock, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := clock.Timer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// newIdempotencyKey returns a new random idempotency key.
+func newIdempotencyKey() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// crypto/rand never fails on supported platforms, but if it does
+		// fall back to a key derived from the current time
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b[:])
+}
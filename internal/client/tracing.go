@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the name of the OpenTelemetry tracer used by the SDK.
+const TracerName = "go.encore.dev/platform-sdk"
+
+// Tracer returns the tracer the client is configured to use, which does
+// not record anything if no tracer provider has been configured.
+func (c *Client) Tracer() trace.Tracer {
+	if c.cfg.TracerProvider == nil {
+		return trace.NewNoopTracerProvider().Tracer(TracerName)
+	}
+	return c.cfg.TracerProvider.Tracer(TracerName)
+}
+
+// TracingEnabled reports whether a tracer provider has been configured.
+func (c *Client) TracingEnabled() bool {
+	return c.cfg.TracerProvider != nil
+}
+
+// TracingInterceptor returns an [Interceptor] which records an OpenTelemetry client span
+// for every request and propagates the trace context to the Encore Platform using the
+// W3C traceparent and tracestate headers.
+func TracingInterceptor(tracer trace.Tracer) Interceptor {
+	propagator := propagation.TraceContext{}
+
+	return func(ctx context.Context, op *Operation, req *http.Request, next Invoker) (*http.Response, error) {
+		ctx, span := tracer.Start(ctx, string(op.Action)+" "+string(op.Object),
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("encore.platform.object", string(op.Object)),
+				attribute.String("encore.platform.action", string(op.Action)),
+				attribute.String("http.method", req.Method),
+				attribute.String("url.path", op.Path),
+			),
+		)
+		defer span.End()
+
+		propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+		resp, err := next(ctx, op, req)
+
+		var apiErr *APIError
+		switch {
+		case errors.As(err, &apiErr):
+			span.SetAttributes(attribute.Int("http.status_code", apiErr.StatusCode))
+			span.RecordError(err)
+			span.SetStatus(codes.Error, apiErr.Error())
+		case err != nil:
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		default:
+			span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+		}
+
+		return resp, err
+	}
+}
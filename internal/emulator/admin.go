@@ -0,0 +1,199 @@
+package emulator
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.encore.dev/platform-sdk/internal/jsonerr"
+)
+
+// TopicStatus describes a topic in the admin API.
+type TopicStatus struct {
+	ID            string   `json:"id"`
+	Subscriptions []string `json:"subscriptions"`
+	Published     int      `json:"published"` // The number of messages published to the topic
+}
+
+// SubscriptionStatus describes a subscription in the admin API.
+type SubscriptionStatus struct {
+	ID           string `json:"id"`
+	Topic        string `json:"topic"`
+	PushEndpoint string `json:"push_endpoint"`
+	Pending      int    `json:"pending"`       // The number of messages waiting to be pushed
+	InFlight     int    `json:"in_flight"`     // The number of messages being pushed
+	Acked        int    `json:"acked"`         // The number of messages acknowledged
+	DeadLettered int    `json:"dead_lettered"` // The number of messages which ran out of delivery attempts
+}
+
+// QueuedMessage describes a message queued for a subscription in the admin API.
+type QueuedMessage struct {
+	Message
+	Attempts    int        `json:"attempts"`               // The number of delivery attempts started
+	InFlight    bool       `json:"in_flight"`              // Whether the message is being pushed
+	NextAttempt *time.Time `json:"next_attempt,omitempty"` // When the message will next be pushed, if it is backing off
+}
+
+// SubscriptionDetails describes a subscription and its queue in the admin API.
+type SubscriptionDetails struct {
+	SubscriptionStatus
+	Queue       []QueuedMessage `json:"queue"`
+	DeadLetters []Message       `json:"dead_letters"`
+}
+
+// handleAdmin serves the admin API, which allows the emulator's queues to be inspected:
+//
+//	GET  /admin/topics                            lists the topics
+//	GET  /admin/subscriptions                     lists the subscriptions
+//	GET  /admin/subscriptions/{id}                describes a subscription and its queue
+//	GET  /admin/subscriptions/{id}/deliveries     lists the completed delivery attempts of a subscription
+//	POST /admin/subscriptions/{id}/purge          removes the messages waiting to be pushed to a subscription
+func (e *Emulator) handleAdmin(w http.ResponseWriter, req *http.Request, path string) {
+	parts := strings.Split(strings.TrimSuffix(path, "/"), "/")
+	for i, part := range parts {
+		unescaped, err := url.PathUnescape(part)
+		if err != nil {
+			jsonerr.Error(w, err, http.StatusBadRequest)
+			return
+		}
+		parts[i] = unescaped
+	}
+
+	method := http.MethodGet
+	var handle func() (any, error)
+	switch {
+	case len(parts) == 1 && parts[0] == "topics":
+		handle = func() (any, error) { return map[string]any{"topics": e.TopicStatuses()}, nil }
+	case len(parts) == 1 && parts[0] == "subscriptions":
+		handle = func() (any, error) { return map[string]any{"subscriptions": e.SubscriptionStatuses()}, nil }
+	case len(parts) == 2 && parts[0] == "subscriptions":
+		handle = func() (any, error) { return e.SubscriptionDetails(parts[1]) }
+	case len(parts) == 3 && parts[0] == "subscriptions" && parts[2] == "deliveries":
+		handle = func() (any, error) {
+			if _, err := e.SubscriptionDetails(parts[1]); err != nil {
+				return nil, err
+			}
+			return map[string]any{"deliveries": e.Deliveries(parts[1])}, nil
+		}
+	case len(parts) == 3 && parts[0] == "subscriptions" && parts[2] == "purge":
+		method = http.MethodPost
+		handle = func() (any, error) {
+			purged, err := e.Purge(parts[1])
+			return map[string]any{"purged": purged}, err
+		}
+	default:
+		jsonerr.Error(w, fmt.Errorf("unknown path %s", req.URL.Path), http.StatusNotFound)
+		return
+	}
+
+	if req.Method != method {
+		jsonerr.Error(w, fmt.Errorf("method %s not allowed", req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	resp, err := handle()
+	if errors.Is(err, errSubscriptionNotFound) {
+		jsonerr.Error(w, err, http.StatusNotFound)
+		return
+	} else if err != nil {
+		jsonerr.Error(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, resp)
+}
+
+// errSubscriptionNotFound is returned by the admin API for unknown subscriptions.
+var errSubscriptionNotFound = errors.New("subscription not found")
+
+// TopicStatuses returns the status of every topic, ordered by ID.
+func (e *Emulator) TopicStatuses() []TopicStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	statuses := make([]TopicStatus, 0, len(e.topics))
+	for _, t := range e.sortedTopicsLocked() {
+		status := TopicStatus{ID: t.id, Subscriptions: []string{}, Published: len(t.messages)}
+		for _, sub := range t.subs {
+			status.Subscriptions = append(status.Subscriptions, sub.id)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// SubscriptionStatuses returns the status of every subscription, ordered by topic.
+func (e *Emulator) SubscriptionStatuses() []SubscriptionStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	statuses := make([]SubscriptionStatus, 0, len(e.subs))
+	for _, t := range e.sortedTopicsLocked() {
+		for _, sub := range t.subs {
+			statuses = append(statuses, sub.statusLocked())
+		}
+	}
+	return statuses
+}
+
+// SubscriptionDetails describes the subscription and its queue.
+func (e *Emulator) SubscriptionDetails(subscriptionID string) (*SubscriptionDetails, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	sub, found := e.subs[subscriptionID]
+	if !found {
+		return nil, fmt.Errorf("%w: %q", errSubscriptionNotFound, subscriptionID)
+	}
+
+	details := &SubscriptionDetails{
+		SubscriptionStatus: sub.statusLocked(),
+		Queue:              []QueuedMessage{},
+		DeadLetters:        []Message{},
+	}
+	for _, q := range sub.queue {
+		queued := QueuedMessage{Message: *q.msg, Attempts: q.attempts, InFlight: q.inFlight}
+		if !q.inFlight && q.notBefore.After(time.Now()) {
+			nextAttempt := q.notBefore
+			queued.NextAttempt = &nextAttempt
+		}
+		details.Queue = append(details.Queue, queued)
+	}
+	for _, msg := range sub.deadLetters {
+		details.DeadLetters = append(details.DeadLetters, *msg)
+	}
+	return details, nil
+}
+
+// Purge removes the messages waiting to be pushed to the subscription,
+// returning how many were removed.
+func (e *Emulator) Purge(subscriptionID string) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	sub, found := e.subs[subscriptionID]
+	if !found {
+		return 0, fmt.Errorf("%w: %q", errSubscriptionNotFound, subscriptionID)
+	}
+	return sub.purgeLocked(), nil
+}
+
+// statusLocked returns the status of the subscription, the caller must hold e.mu.
+func (s *subscription) statusLocked() SubscriptionStatus {
+	status := SubscriptionStatus{
+		ID:           s.id,
+		Topic:        s.topic,
+		PushEndpoint: s.cfg.PushEndpoint,
+		Acked:        s.acked,
+		DeadLettered: len(s.deadLetters),
+	}
+	for _, q := range s.queue {
+		if q.inFlight {
+			status.InFlight++
+		} else {
+			status.Pending++
+		}
+	}
+	return status
+}
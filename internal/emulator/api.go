@@ -0,0 +1,221 @@
+package emulator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/clock"
+
+	"go.encore.dev/platform-sdk/encorecloud"
+	"go.encore.dev/platform-sdk/encorecloud/types"
+	"go.encore.dev/platform-sdk/internal/client"
+	"go.encore.dev/platform-sdk/internal/jsonerr"
+	"go.encore.dev/platform-sdk/pkg/auth"
+)
+
+// ErrTopicNotFound is returned when publishing to a topic which does not exist.
+var ErrTopicNotFound = errors.New("topic not found")
+
+// ServeHTTP serves the Encore Cloud API used by the SDK, along with the admin API under /admin/.
+func (e *Emulator) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := req.URL.EscapedPath()
+	switch {
+	case path == "/v1/ping":
+		e.handlePing(w, req)
+	case strings.HasPrefix(path, "/v1/pubsub/"):
+		e.handlePubsub(w, req, strings.TrimPrefix(path, "/v1/pubsub/"))
+	case strings.HasPrefix(path, "/admin/"):
+		e.handleAdmin(w, req, strings.TrimPrefix(path, "/admin/"))
+	default:
+		jsonerr.Error(w, fmt.Errorf("unknown path %s", req.URL.Path), http.StatusNotFound)
+	}
+}
+
+// verify verifies the request is signed by one of the emulator's keys,
+// writing an error response and returning false if it isn't.
+func (e *Emulator) verify(w http.ResponseWriter, req *http.Request) (auth.OperationHash, bool) {
+	opHash, err := auth.GetVerifiedOperationHash(req, e.cfg.Keys, clock.New())
+	if err != nil {
+		jsonerr.Error(w, err, http.StatusUnauthorized)
+		return "", false
+	}
+	return opHash, true
+}
+
+func (e *Emulator) handlePing(w http.ResponseWriter, req *http.Request) {
+	opHash, ok := e.verify(w, req)
+	if !ok {
+		return
+	}
+	if valid, err := opHash.Verify(auth.Ping, auth.Read, nil); err != nil || !valid {
+		jsonerr.Error(w, auth.ErrAuthenticationFailed, http.StatusUnauthorized)
+		return
+	}
+
+	writeJSON(w, &types.PingResponse{ServerTime: time.Now(), APIVersions: []string{"v1"}})
+}
+
+func (e *Emulator) handlePubsub(w http.ResponseWriter, req *http.Request, path string) {
+	// The path is {topic}/publish or {topic}/publish-batch
+	parts := strings.Split(path, "/")
+	if len(parts) != 2 || (parts[1] != "publish" && parts[1] != "publish-batch") {
+		jsonerr.Error(w, fmt.Errorf("unknown path %s", req.URL.Path), http.StatusNotFound)
+		return
+	}
+	if req.Method != http.MethodPost {
+		jsonerr.Error(w, fmt.Errorf("method %s not allowed", req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	topicID, err := url.PathUnescape(parts[0])
+	if err != nil {
+		jsonerr.Error(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if parts[1] == "publish-batch" {
+		e.handlePublishBatch(w, req, topicID)
+	} else {
+		e.handlePublish(w, req, topicID)
+	}
+}
+
+func (e *Emulator) handlePublish(w http.ResponseWriter, req *http.Request, topicID string) {
+	opHash, ok := e.verify(w, req)
+	if !ok {
+		return
+	}
+
+	params := &types.PublishParams{}
+	if !decodeBody(w, req, params) {
+		return
+	}
+	if valid, err := opHash.Verify(auth.PubsubMsg, auth.Create, params, []byte(topicID)); err != nil || !valid {
+		jsonerr.Error(w, auth.ErrAuthenticationFailed, http.StatusUnauthorized)
+		return
+	}
+	if err := params.Validate(); err != nil {
+		jsonerr.Error(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if !e.runPublishHook(w, topicID) {
+		return
+	}
+
+	msg, duplicate, err := e.Publish(topicID, params)
+	if errors.Is(err, ErrTopicNotFound) {
+		jsonerr.Error(w, err, http.StatusNotFound)
+		return
+	} else if err != nil {
+		jsonerr.Error(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, &types.PublishResponse{MessageID: msg.ID, Duplicate: duplicate})
+}
+
+func (e *Emulator) handlePublishBatch(w http.ResponseWriter, req *http.Request, topicID string) {
+	opHash, ok := e.verify(w, req)
+	if !ok {
+		return
+	}
+
+	params := &types.PublishBatchParams{}
+	if !decodeBody(w, req, params) {
+		return
+	}
+	if valid, err := opHash.Verify(auth.PubsubMsg, auth.Create, params, []byte(topicID)); err != nil || !valid {
+		jsonerr.Error(w, auth.ErrAuthenticationFailed, http.StatusUnauthorized)
+		return
+	}
+	if err := params.Validate(); err != nil {
+		jsonerr.Error(w, err, http.StatusBadRequest)
+		return
+	} else if len(params.Messages) > encorecloud.MaxBatchMessages {
+		jsonerr.Error(w, encorecloud.ErrBatchTooLarge, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if !e.runPublishHook(w, topicID) {
+		return
+	}
+
+	// Messages are validated individually, so that one invalid message doesn't fail the rest,
+	// except for later messages with the same ordering key which would otherwise be out of order
+	resp := &types.PublishBatchResponse{Results: make([]*types.PublishBatchResult, len(params.Messages))}
+	failedKeys := make(map[string]bool)
+	for i, msgParams := range params.Messages {
+		result := &types.PublishBatchResult{}
+		resp.Results[i] = result
+		if msgParams == nil {
+			result.Error = "message must be provided"
+			continue
+		} else if failedKeys[msgParams.OrderingKey] {
+			result.Error = "an earlier message with the same ordering key failed to publish"
+			continue
+		} else if err := msgParams.Validate(); err != nil {
+			result.Error = err.Error()
+			if msgParams.OrderingKey != "" {
+				failedKeys[msgParams.OrderingKey] = true
+			}
+			continue
+		}
+
+		msg, duplicate, err := e.Publish(topicID, msgParams)
+		if errors.Is(err, ErrTopicNotFound) {
+			jsonerr.Error(w, err, http.StatusNotFound)
+			return
+		} else if err != nil {
+			result.Error = err.Error()
+			if msgParams.OrderingKey != "" {
+				failedKeys[msgParams.OrderingKey] = true
+			}
+			continue
+		}
+		result.MessageID, result.Duplicate = msg.ID, duplicate
+	}
+
+	writeJSON(w, resp)
+}
+
+// runPublishHook runs the publish hook if one is set, writing an error response
+// and returning false if the hook fails the publish.
+func (e *Emulator) runPublishHook(w http.ResponseWriter, topicID string) bool {
+	e.mu.Lock()
+	hook := e.publishHook
+	e.mu.Unlock()
+	if hook != nil {
+		if status, fail := hook(topicID); fail {
+			jsonerr.Error(w, errors.New("injected publish failure"), status)
+			return false
+		}
+	}
+	return true
+}
+
+// decodeBody decodes the possibly compressed JSON request body into v,
+// writing an error response and returning false if it can't.
+func decodeBody(w http.ResponseWriter, req *http.Request, v any) bool {
+	body, err := client.Decompress(req.Header.Get("Content-Encoding"), req.Body)
+	if err != nil {
+		jsonerr.Error(w, err, http.StatusUnsupportedMediaType)
+		return false
+	}
+	defer func() { _ = body.Close() }()
+
+	if err := json.NewDecoder(body).Decode(v); err != nil {
+		jsonerr.Error(w, fmt.Errorf("invalid request body: %w", err), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,339 @@
+// Package emulator implements an in-memory emulation of Encore Cloud PubSub.
+//
+// It is used both by the encore-pubsub-emulator command, for offline development,
+// and by the platformtest package, for integration tests.
+package emulator
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go.encore.dev/platform-sdk/encorecloud/types"
+	"go.encore.dev/platform-sdk/pkg/auth"
+	"go.encore.dev/platform-sdk/pkg/logging"
+)
+
+// Config configures an [Emulator].
+type Config struct {
+	AppSlug string     // The app slug requests are signed for
+	EnvName string     // The environment name requests are signed for
+	Keys    []auth.Key // The auth keys shared with the SDK
+
+	Topics              map[string]TopicConfig // The topics, keyed by their ID
+	AutoCreateTopics    bool                   // Whether publishing to an unknown topic creates it, rather than failing
+	DeduplicationWindow time.Duration          // How long deduplication IDs are remembered for (defaults to 10m)
+
+	Logger     logging.Logger // The logger to log to (logging is disabled if nil)
+	HTTPClient *http.Client   // The client to push messages with (defaults to http.DefaultClient)
+}
+
+// TopicConfig configures a topic.
+type TopicConfig struct {
+	Subscriptions map[string]SubscriptionConfig // The subscriptions to the topic, keyed by their ID
+}
+
+// SubscriptionConfig configures a subscription.
+type SubscriptionConfig struct {
+	PushEndpoint        string        // The URL messages are pushed to
+	AckDeadline         time.Duration // How long a push may go without a keepalive before it is failed (defaults to 30s)
+	MaxDeliveryAttempts int           // The number of times a message is pushed before it is dead lettered (defaults to 5)
+	MinBackoff          time.Duration // The delay before the first redelivery of a failed message (defaults to 1s)
+	MaxBackoff          time.Duration // The maximum delay between redeliveries (defaults to 1m)
+	MaxInFlight         int           // The maximum number of messages pushed concurrently (defaults to 10)
+	MaxBatchSize        int           // The maximum number of messages pushed in a single request (defaults to 10)
+}
+
+func (cfg SubscriptionConfig) withDefaults() SubscriptionConfig {
+	if cfg.AckDeadline <= 0 {
+		cfg.AckDeadline = 30 * time.Second
+	}
+	if cfg.MaxDeliveryAttempts <= 0 {
+		cfg.MaxDeliveryAttempts = 5
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = time.Second
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = time.Minute
+		if cfg.MaxBackoff < cfg.MinBackoff {
+			cfg.MaxBackoff = cfg.MinBackoff
+		}
+	}
+	if cfg.MaxInFlight <= 0 {
+		cfg.MaxInFlight = 10
+	}
+	if cfg.MaxBatchSize <= 0 {
+		cfg.MaxBatchSize = 10
+	}
+	return cfg
+}
+
+// backoff returns the delay before redelivering a message which failed the given attempt.
+func (cfg SubscriptionConfig) backoff(attempt int) time.Duration {
+	backoff := cfg.MinBackoff
+	for i := 1; i < attempt && backoff < cfg.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > cfg.MaxBackoff {
+		backoff = cfg.MaxBackoff
+	}
+	return backoff
+}
+
+// Message is a published message.
+type Message struct {
+	ID          string            `json:"id"`
+	Topic       string            `json:"topic"`
+	OrderingKey string            `json:"ordering_key,omitempty"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	Data        []byte            `json:"data"`
+	PublishTime time.Time         `json:"publish_time"`
+	DeliverAt   *time.Time        `json:"deliver_at,omitempty"` // When the message is first delivered, if it was delayed
+
+	DeduplicationID string `json:"deduplication_id,omitempty"`
+}
+
+// Delivery is a completed attempt to push a message to a subscription.
+type Delivery struct {
+	Subscription string    `json:"subscription"`
+	MessageID    string    `json:"message_id"`
+	Attempt      int       `json:"attempt"`         // The delivery attempt, starting at 1
+	Acked        bool      `json:"acked"`           // Whether the subscription acknowledged the message
+	Error        string    `json:"error,omitempty"` // Why the delivery failed, if it was not acknowledged
+	Time         time.Time `json:"time"`            // When the delivery completed
+}
+
+// Emulator emulates Encore Cloud PubSub.
+//
+// It serves the Encore Cloud API used by the SDK, and pushes published messages to the
+// push endpoints of their topic's subscriptions using signed push requests. Messages with
+// the same ordering key are pushed to a subscription one at a time in the order they were
+// published, messages published with a delivery time are held back until then, and messages
+// which are nacked or time out are redelivered with an increasing delivery attempt until they
+// run out of attempts.
+type Emulator struct {
+	cfg        Config
+	latestKey  auth.Key
+	httpClient *http.Client
+	logger     logging.Logger
+	ctx        context.Context
+	cancel     context.CancelFunc
+	running    sync.WaitGroup
+
+	mu          sync.Mutex
+	nextID      int
+	topics      map[string]*topic
+	subs        map[string]*subscription
+	unsettled   int           // the number of messages not yet acked or dead lettered by each subscription
+	changed     chan struct{} // closed whenever unsettled changes
+	publishHook func(topicID string) (status int, fail bool)
+}
+
+type topic struct {
+	id       string
+	subs     []*subscription
+	messages []*Message
+	dedup    map[string]*Message // the messages published with each deduplication ID
+}
+
+// New creates a new emulator, which must be closed once it is no longer used.
+func New(cfg Config) *Emulator {
+	e := &Emulator{
+		cfg:        cfg,
+		httpClient: cfg.HTTPClient,
+		logger:     cfg.Logger,
+		topics:     make(map[string]*topic),
+		subs:       make(map[string]*subscription),
+		changed:    make(chan struct{}),
+	}
+	if e.httpClient == nil {
+		e.httpClient = http.DefaultClient
+	}
+	if e.logger == nil {
+		e.logger = logging.Discard{}
+	}
+	if e.cfg.DeduplicationWindow <= 0 {
+		e.cfg.DeduplicationWindow = 10 * time.Minute
+	}
+	for _, key := range cfg.Keys {
+		if key.KeyID > e.latestKey.KeyID {
+			e.latestKey = key
+		}
+	}
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+
+	for topicID, topicCfg := range cfg.Topics {
+		e.topicLocked(topicID)
+		for subID, subCfg := range topicCfg.Subscriptions {
+			_ = e.Subscribe(topicID, subID, subCfg)
+		}
+	}
+	return e
+}
+
+// Close stops the emulator, abandoning any pushes in progress.
+func (e *Emulator) Close() {
+	e.cancel()
+	e.running.Wait()
+}
+
+// topicLocked returns the topic with the given ID, creating it if needed.
+// The caller must hold e.mu, unless the emulator is being created.
+func (e *Emulator) topicLocked(topicID string) *topic {
+	t, found := e.topics[topicID]
+	if !found {
+		t = &topic{id: topicID, dedup: make(map[string]*Message)}
+		e.topics[topicID] = t
+	}
+	return t
+}
+
+// Subscribe adds a subscription to the topic, creating the topic if needed. Messages
+// published to the topic from now on are pushed to the subscription's push endpoint.
+func (e *Emulator) Subscribe(topicID, subscriptionID string, cfg SubscriptionConfig) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, found := e.subs[subscriptionID]; found {
+		return fmt.Errorf("subscription %q already exists", subscriptionID)
+	}
+
+	sub := &subscription{
+		e:     e,
+		id:    subscriptionID,
+		topic: topicID,
+		cfg:   cfg.withDefaults(),
+		wake:  make(chan struct{}, 1),
+	}
+	t := e.topicLocked(topicID)
+	t.subs = append(t.subs, sub)
+	e.subs[subscriptionID] = sub
+
+	e.running.Add(1)
+	go sub.dispatch()
+	return nil
+}
+
+// Publish publishes a message to the topic, returning the stored message.
+//
+// If a message with the same deduplication ID was published to the topic within the
+// deduplication window, the message is not published and the original message is
+// returned along with duplicate set.
+func (e *Emulator) Publish(topicID string, params *types.PublishParams) (msg *Message, duplicate bool, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	t, found := e.topics[topicID]
+	if !found {
+		if !e.cfg.AutoCreateTopics {
+			return nil, false, fmt.Errorf("%w: %q", ErrTopicNotFound, topicID)
+		}
+		t = e.topicLocked(topicID)
+	}
+
+	now := time.Now()
+	if id := params.DeduplicationID; id != "" {
+		if original, found := t.dedup[id]; found && now.Sub(original.PublishTime) < e.cfg.DeduplicationWindow {
+			return original, true, nil
+		}
+	}
+
+	e.nextID++
+	msg = &Message{
+		ID:          fmt.Sprintf("msg-%d", e.nextID),
+		Topic:       topicID,
+		OrderingKey: params.OrderingKey,
+		Attributes:  params.Attributes,
+		Data:        append([]byte(nil), params.Payload...),
+		PublishTime: now,
+		DeliverAt:   params.DeliverAt,
+
+		DeduplicationID: params.DeduplicationID,
+	}
+	if params.DeliverAfterMillis > 0 {
+		deliverAt := now.Add(time.Duration(params.DeliverAfterMillis) * time.Millisecond)
+		msg.DeliverAt = &deliverAt
+	}
+	t.messages = append(t.messages, msg)
+	if msg.DeduplicationID != "" {
+		t.dedup[msg.DeduplicationID] = msg
+	}
+	for _, sub := range t.subs {
+		sub.enqueueLocked(msg)
+	}
+	return msg, false, nil
+}
+
+// Published returns the messages published to the topic, in the order they were published.
+func (e *Emulator) Published(topicID string) []Message {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var messages []Message
+	if t, found := e.topics[topicID]; found {
+		for _, msg := range t.messages {
+			messages = append(messages, *msg)
+		}
+	}
+	return messages
+}
+
+// Deliveries returns the completed attempts to push messages to the subscription,
+// in the order they completed.
+func (e *Emulator) Deliveries(subscriptionID string) []Delivery {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if sub, found := e.subs[subscriptionID]; found {
+		return append([]Delivery(nil), sub.deliveries...)
+	}
+	return nil
+}
+
+// Wait waits until every message published so far has either been acknowledged
+// by each of its subscriptions, or has been dead lettered.
+func (e *Emulator) Wait(ctx context.Context) error {
+	for {
+		e.mu.Lock()
+		unsettled, changed := e.unsettled, e.changed
+		e.mu.Unlock()
+		if unsettled == 0 {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for %d messages to be delivered: %w", unsettled, ctx.Err())
+		}
+	}
+}
+
+// settledLocked records that n messages have been settled, the caller must hold e.mu.
+func (e *Emulator) settledLocked(n int) {
+	e.unsettled -= n
+	close(e.changed)
+	e.changed = make(chan struct{})
+}
+
+// SetPublishHook sets a function which is called for every publish request before the message
+// is published. If it returns fail, the request fails with the returned status code instead.
+func (e *Emulator) SetPublishHook(hook func(topicID string) (status int, fail bool)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.publishHook = hook
+}
+
+// sortedTopicsLocked returns the topics ordered by ID, the caller must hold e.mu.
+func (e *Emulator) sortedTopicsLocked() []*topic {
+	topics := make([]*topic, 0, len(e.topics))
+	for _, t := range e.topics {
+		topics = append(topics, t)
+	}
+	sort.Slice(topics, func(i, j int) bool { return topics[i].id < topics[j].id })
+	return topics
+}
@@ -0,0 +1,449 @@
+package emulator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	platform "go.encore.dev/platform-sdk"
+	"go.encore.dev/platform-sdk/encorecloud"
+	"go.encore.dev/platform-sdk/internal/client"
+	"go.encore.dev/platform-sdk/pkg/auth"
+)
+
+var testKey = auth.Key{KeyID: 1, Data: []byte("test-key-data")} // nolint: gochecknoglobals
+
+// newTestEmulator starts an emulator serving the given topics, returning it
+// along with an SDK configured to use it.
+func newTestEmulator(t *testing.T, topics map[string]TopicConfig) (*Emulator, *platform.SDK, string) {
+	e := New(Config{AppSlug: "test-app", EnvName: "test-env", Keys: []auth.Key{testKey}, Topics: topics})
+	srv := httptest.NewServer(e)
+	t.Cleanup(func() {
+		e.Close()
+		srv.Close()
+	})
+
+	sdk := platform.NewSDK(
+		platform.WithHost(srv.URL),
+		platform.WithAppDetails("test-app", "test-env"),
+		platform.WithAuthKeys(testKey),
+		platform.WithRetryPolicy(platform.RetryPolicy{MaxAttempts: 1}),
+	)
+	return e, sdk, srv.URL
+}
+
+// callback is the signature of a subscription callback.
+type callback = func(ctx context.Context, msgID string, publishTime time.Time, deliveryAttempt int, attrs map[string]string, data []byte) error
+
+// newPushEndpoint serves a subscription handler created by the SDK, returning its URL.
+func newPushEndpoint(t *testing.T, sdk *platform.SDK, subscriptionID string, fn callback) string {
+	srv := httptest.NewServer(sdk.EncoreCloud.CreateSubscriptionHandler(subscriptionID, nil, fn))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// limitPushVersions wraps a push endpoint handler to behave like one built with an SDK
+// which only supports push versions up to maxVersion, or all of them if it is zero.
+func limitPushVersions(maxVersion int, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if maxVersion == 0 {
+			handler(w, req)
+			return
+		}
+
+		var supported []string
+		for _, version := range strings.Split(req.Header.Get(encorecloud.PushVersionAcceptHeader), ",") {
+			if v, err := strconv.Atoi(strings.TrimSpace(version)); err == nil && v <= maxVersion {
+				supported = append(supported, strconv.Itoa(v))
+			}
+		}
+		if len(supported) == 0 {
+			http.Error(w, "unsupported push version", http.StatusNotAcceptable)
+			return
+		}
+		req.Header.Set(encorecloud.PushVersionAcceptHeader, strings.Join(supported, ", "))
+		handler(w, req)
+	}
+}
+
+func TestEmulator_OrderingAndRedelivery(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	var mu sync.Mutex
+	var received []string
+	fn := func(ctx context.Context, msgID string, publishTime time.Time, deliveryAttempt int, attrs map[string]string, data []byte) error {
+		mu.Lock()
+		received = append(received, string(data))
+		mu.Unlock()
+
+		if string(data) == `"a1"` && deliveryAttempt < 3 {
+			return errors.New("try again")
+		}
+		return nil
+	}
+
+	e, sdk, _ := newTestEmulator(t, map[string]TopicConfig{"orders": {}})
+	endpoint := newPushEndpoint(t, sdk, "ship", fn)
+	c.Assert(e.Subscribe("orders", "ship", SubscriptionConfig{PushEndpoint: endpoint, MinBackoff: 10 * time.Millisecond}), qt.IsNil)
+
+	ctx := context.Background()
+	for _, msg := range []string{"a1", "a2", "a3"} {
+		_, err := sdk.EncoreCloud.PublishToTopic(ctx, "orders", "a", nil, []byte(`"`+msg+`"`))
+		c.Assert(err, qt.IsNil)
+	}
+	c.Assert(e.Wait(ctx), qt.IsNil)
+
+	// Messages with the same ordering key are delivered in order,
+	// with later messages waiting for the redelivery of earlier ones
+	c.Assert(received, qt.DeepEquals, []string{`"a1"`, `"a1"`, `"a1"`, `"a2"`, `"a3"`})
+
+	deliveries := e.Deliveries("ship")
+	c.Assert(deliveries, qt.HasLen, 5)
+	for i, want := range []struct {
+		attempt int
+		acked   bool
+	}{{1, false}, {2, false}, {3, true}, {1, true}, {1, true}} {
+		c.Assert(deliveries[i].Attempt, qt.Equals, want.attempt)
+		c.Assert(deliveries[i].Acked, qt.Equals, want.acked)
+	}
+	c.Assert(deliveries[0].Error, qt.Equals, "nacked: try again")
+	c.Assert(deliveries[1].Time.Sub(deliveries[0].Time) >= 10*time.Millisecond, qt.IsTrue)
+}
+
+func TestEmulator_AckDeadline(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	fn := func(ctx context.Context, msgID string, publishTime time.Time, deliveryAttempt int, attrs map[string]string, data []byte) error {
+		if deliveryAttempt == 1 {
+			// Block without the handler sending a keepalive in time
+			<-ctx.Done()
+		}
+		return nil
+	}
+
+	e, sdk, _ := newTestEmulator(t, nil)
+	endpoint := newPushEndpoint(t, sdk, "ship", fn)
+	c.Assert(e.Subscribe("orders", "ship", SubscriptionConfig{
+		PushEndpoint: endpoint,
+		AckDeadline:  50 * time.Millisecond,
+		MinBackoff:   time.Millisecond,
+	}), qt.IsNil)
+
+	ctx := context.Background()
+	msgID, err := sdk.EncoreCloud.PublishToTopic(ctx, "orders", "", nil, []byte(`{}`))
+	c.Assert(err, qt.IsNil)
+	c.Assert(e.Wait(ctx), qt.IsNil)
+
+	deliveries := e.Deliveries("ship")
+	c.Assert(deliveries, qt.HasLen, 2)
+	c.Assert(deliveries[0].MessageID, qt.Equals, msgID)
+	c.Assert(deliveries[0].Error, qt.Equals, "ack deadline exceeded")
+	c.Assert(deliveries[1].Attempt, qt.Equals, 2)
+	c.Assert(deliveries[1].Acked, qt.IsTrue)
+}
+
+func TestEmulator_RetryAfterAndPermanent(t *testing.T) {
+	t.Parallel()
+
+	for _, maxVersion := range []int{0, 2} {
+		maxVersion := maxVersion
+		t.Run(fmt.Sprintf("max version %d", maxVersion), func(t *testing.T) {
+			t.Parallel()
+			testRetryAfterAndPermanent(t, maxVersion)
+		})
+	}
+}
+
+// testRetryAfterAndPermanent checks nacks asking for a delayed retry or none at all are
+// honoured when pushing to an endpoint supporting up to the given push version.
+func testRetryAfterAndPermanent(t *testing.T, maxVersion int) {
+	c := qt.New(t)
+
+	fn := func(ctx context.Context, msgID string, publishTime time.Time, deliveryAttempt int, attrs map[string]string, data []byte) error {
+		switch {
+		case string(data) == `"invalid"`:
+			return encorecloud.Permanent(errors.New("invalid message"))
+		case deliveryAttempt == 1:
+			return encorecloud.RetryAfter(10*time.Millisecond, errors.New("busy"))
+		}
+		return nil
+	}
+
+	// The backoff is long enough that the test would time out if it was used
+	e, sdk, _ := newTestEmulator(t, nil)
+	srv := httptest.NewServer(limitPushVersions(maxVersion, sdk.EncoreCloud.CreateSubscriptionHandler("ship", nil, fn)))
+	t.Cleanup(srv.Close)
+	c.Assert(e.Subscribe("orders", "ship", SubscriptionConfig{PushEndpoint: srv.URL, MinBackoff: time.Hour}), qt.IsNil)
+
+	ctx := context.Background()
+	invalidID, err := sdk.EncoreCloud.PublishToTopic(ctx, "orders", "", nil, []byte(`"invalid"`))
+	c.Assert(err, qt.IsNil)
+	validID, err := sdk.EncoreCloud.PublishToTopic(ctx, "orders", "", nil, []byte(`"valid"`))
+	c.Assert(err, qt.IsNil)
+	c.Assert(e.Wait(ctx), qt.IsNil)
+
+	details, err := e.SubscriptionDetails("ship")
+	c.Assert(err, qt.IsNil)
+	c.Assert(details.DeadLetters, qt.HasLen, 1)
+	c.Assert(details.DeadLetters[0].ID, qt.Equals, invalidID)
+
+	var validAttempts []Delivery
+	for _, delivery := range e.Deliveries("ship") {
+		if delivery.MessageID == validID {
+			validAttempts = append(validAttempts, delivery)
+		}
+	}
+	c.Assert(validAttempts, qt.HasLen, 2)
+	c.Assert(validAttempts[0].Error, qt.Equals, "nacked: busy")
+	c.Assert(validAttempts[1].Acked, qt.IsTrue)
+	c.Assert(validAttempts[1].Time.Sub(validAttempts[0].Time) >= 10*time.Millisecond, qt.IsTrue)
+}
+
+func TestEmulator_UnknownTopic(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	_, sdk, _ := newTestEmulator(t, map[string]TopicConfig{"orders": {}})
+	_, err := sdk.EncoreCloud.PublishToTopic(context.Background(), "unknown", "", nil, []byte(`{}`))
+	var apiErr *client.APIError
+	c.Assert(errors.As(err, &apiErr), qt.IsTrue)
+	c.Assert(apiErr.StatusCode, qt.Equals, http.StatusNotFound)
+}
+
+func TestEmulator_PublishBatch(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	var mu sync.Mutex
+	var received []string
+	fn := func(ctx context.Context, msgID string, publishTime time.Time, deliveryAttempt int, attrs map[string]string, data []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, string(data))
+		return nil
+	}
+
+	e, sdk, _ := newTestEmulator(t, map[string]TopicConfig{"orders": {}})
+	c.Assert(e.Subscribe("orders", "ship", SubscriptionConfig{PushEndpoint: newPushEndpoint(t, sdk, "ship", fn)}), qt.IsNil)
+
+	ctx := context.Background()
+	results, err := sdk.EncoreCloud.PublishBatch(ctx, "orders", []encorecloud.Message{
+		{OrderingKey: "a", Data: []byte(`1`)},
+		{OrderingKey: "a", Data: []byte(`2`)},
+		{OrderingKey: "a", Data: []byte(`3`)},
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(results, qt.HasLen, 3)
+
+	published := e.Published("orders")
+	c.Assert(published, qt.HasLen, 3)
+	for i, result := range results {
+		c.Assert(result.Err, qt.IsNil)
+		c.Assert(published[i].ID, qt.Equals, result.MessageID)
+	}
+
+	c.Assert(e.Wait(ctx), qt.IsNil)
+	c.Assert(received, qt.DeepEquals, []string{"1", "2", "3"})
+
+	_, err = sdk.EncoreCloud.PublishBatch(ctx, "unknown", []encorecloud.Message{{Data: []byte(`1`)}})
+	var apiErr *client.APIError
+	c.Assert(errors.As(err, &apiErr), qt.IsTrue)
+	c.Assert(apiErr.StatusCode, qt.Equals, http.StatusNotFound)
+}
+
+func TestEmulator_Deduplication(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	e, sdk, _ := newTestEmulator(t, map[string]TopicConfig{"orders": {}})
+	ctx := context.Background()
+
+	publish := func(data string, options ...encorecloud.PublishOption) (string, bool) {
+		var duplicate bool
+		msgID, err := sdk.EncoreCloud.PublishToTopic(ctx, "orders", "", nil, []byte(data), append(options, encorecloud.ReportDuplicate(&duplicate))...)
+		c.Assert(err, qt.IsNil)
+		return msgID, duplicate
+	}
+	first, duplicate := publish(`1`, encorecloud.WithDeduplicationID("order-1"))
+	c.Assert(duplicate, qt.IsFalse)
+	retried, duplicate := publish(`1`, encorecloud.WithDeduplicationID("order-1"))
+	c.Assert(duplicate, qt.IsTrue)
+	c.Assert(retried, qt.Equals, first)
+	other, duplicate := publish(`1`)
+	c.Assert(duplicate, qt.IsFalse)
+	c.Assert(other, qt.Not(qt.Equals), first)
+
+	results, err := sdk.EncoreCloud.PublishBatch(ctx, "orders", []encorecloud.Message{
+		{Data: []byte(`1`), DeduplicationID: "order-1"},
+		{Data: []byte(`2`), DeduplicationID: "order-2"},
+		{Data: []byte(`2`), DeduplicationID: "order-2"},
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(results[0], qt.DeepEquals, encorecloud.BatchResult{MessageID: first, Duplicate: true})
+	c.Assert(results[1].Duplicate, qt.IsFalse)
+	c.Assert(results[2], qt.DeepEquals, encorecloud.BatchResult{MessageID: results[1].MessageID, Duplicate: true})
+
+	c.Assert(e.Published("orders"), qt.HasLen, 3)
+}
+
+func TestEmulator_BatchedPush(t *testing.T) {
+	t.Parallel()
+
+	unbatched := []string{"3", "3", "1, 2", "1, 2", "1, 2", "1, 2", "1, 2"}
+	tests := []struct {
+		name         string
+		maxVersion   int      // the highest push version the endpoint supports, if limited
+		wantRequests []string // the push versions accepted by each request
+	}{
+		{name: "batched", wantRequests: []string{"3", "3"}},
+		{name: "v2 fallback", maxVersion: 2, wantRequests: unbatched},
+		{name: "v1 fallback", maxVersion: 1, wantRequests: unbatched},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := qt.New(t)
+
+			e, sdk, _ := newTestEmulator(t, nil)
+			handler := sdk.EncoreCloud.CreateSubscriptionHandler("ship", nil, func(ctx context.Context, msgID string, publishTime time.Time, deliveryAttempt int, attrs map[string]string, data []byte) error {
+				return nil
+			})
+
+			var mu sync.Mutex
+			var requests []string
+			limited := limitPushVersions(tt.maxVersion, handler)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				mu.Lock()
+				requests = append(requests, req.Header.Get(encorecloud.PushVersionAcceptHeader))
+				mu.Unlock()
+				limited(w, req)
+			}))
+			t.Cleanup(srv.Close)
+			c.Assert(e.Subscribe("orders", "ship", SubscriptionConfig{PushEndpoint: srv.URL, MaxBatchSize: 3}), qt.IsNil)
+
+			// Delay the messages so that they are all ready at the same time
+			ctx := context.Background()
+			deliverAt := time.Now().Add(200 * time.Millisecond)
+			for i := 0; i < 5; i++ {
+				_, err := sdk.EncoreCloud.PublishToTopic(ctx, "orders", "", nil, []byte(`{}`), encorecloud.DeliverAt(deliverAt))
+				c.Assert(err, qt.IsNil)
+			}
+			c.Assert(e.Wait(ctx), qt.IsNil)
+
+			c.Assert(requests, qt.DeepEquals, tt.wantRequests)
+			deliveries := e.Deliveries("ship")
+			c.Assert(deliveries, qt.HasLen, 5)
+			for _, delivery := range deliveries {
+				c.Assert(delivery.Acked, qt.IsTrue)
+				c.Assert(delivery.Attempt, qt.Equals, 1, qt.Commentf("the rejected push version should not count as an attempt"))
+			}
+		})
+	}
+}
+
+func TestEmulator_Admin(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	block := make(chan struct{})
+	fn := func(ctx context.Context, msgID string, publishTime time.Time, deliveryAttempt int, attrs map[string]string, data []byte) error {
+		select {
+		case <-block:
+		case <-ctx.Done():
+		}
+		return nil
+	}
+
+	e, sdk, url := newTestEmulator(t, nil)
+	c.Assert(e.Subscribe("orders", "ship", SubscriptionConfig{PushEndpoint: newPushEndpoint(t, sdk, "ship", fn), MaxInFlight: 1}), qt.IsNil)
+	c.Assert(e.Subscribe("orders", "bill", SubscriptionConfig{PushEndpoint: newPushEndpoint(t, sdk, "bill", fn), MaxInFlight: 1}), qt.IsNil)
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		_, err := sdk.EncoreCloud.PublishToTopic(ctx, "orders", "", nil, []byte(`{}`))
+		c.Assert(err, qt.IsNil)
+	}
+
+	get := func(method, path string, v any) int {
+		req, err := http.NewRequest(method, url+path, nil)
+		c.Assert(err, qt.IsNil)
+		resp, err := http.DefaultClient.Do(req)
+		c.Assert(err, qt.IsNil)
+		defer func() { _ = resp.Body.Close() }()
+		if v != nil {
+			c.Assert(json.NewDecoder(resp.Body).Decode(v), qt.IsNil)
+		}
+		return resp.StatusCode
+	}
+
+	var topics struct{ Topics []TopicStatus }
+	c.Assert(get(http.MethodGet, "/admin/topics", &topics), qt.Equals, http.StatusOK)
+	c.Assert(topics.Topics, qt.DeepEquals, []TopicStatus{{ID: "orders", Subscriptions: []string{"ship", "bill"}, Published: 3}})
+
+	// Only one message is pushed at a time, so the others are pending
+	waitFor(c, func() bool { return e.SubscriptionStatuses()[0].InFlight == 1 })
+	var subs struct{ Subscriptions []SubscriptionStatus }
+	c.Assert(get(http.MethodGet, "/admin/subscriptions", &subs), qt.Equals, http.StatusOK)
+	c.Assert(subs.Subscriptions, qt.HasLen, 2)
+	c.Assert(subs.Subscriptions[0].ID, qt.Equals, "ship")
+	c.Assert(subs.Subscriptions[0].Pending, qt.Equals, 2)
+	c.Assert(subs.Subscriptions[0].InFlight, qt.Equals, 1)
+
+	var details SubscriptionDetails
+	c.Assert(get(http.MethodGet, "/admin/subscriptions/ship", &details), qt.Equals, http.StatusOK)
+	c.Assert(details.Queue, qt.HasLen, 3)
+	c.Assert(details.Queue[0].InFlight, qt.IsTrue)
+	c.Assert(details.Queue[0].Attempts, qt.Equals, 1)
+
+	// Purging removes the pending messages
+	var purged struct{ Purged int }
+	c.Assert(get(http.MethodGet, "/admin/subscriptions/ship/purge", nil), qt.Equals, http.StatusMethodNotAllowed)
+	c.Assert(get(http.MethodPost, "/admin/subscriptions/ship/purge", &purged), qt.Equals, http.StatusOK)
+	c.Assert(purged.Purged, qt.Equals, 2)
+
+	close(block)
+	c.Assert(e.Wait(ctx), qt.IsNil)
+
+	var deliveries struct{ Deliveries []Delivery }
+	c.Assert(get(http.MethodGet, "/admin/subscriptions/ship/deliveries", &deliveries), qt.Equals, http.StatusOK)
+	c.Assert(deliveries.Deliveries, qt.HasLen, 1)
+	c.Assert(get(http.MethodGet, "/admin/subscriptions/bill/deliveries", &deliveries), qt.Equals, http.StatusOK)
+	c.Assert(deliveries.Deliveries, qt.HasLen, 3)
+	c.Assert(get(http.MethodGet, "/admin/subscriptions/unknown", nil), qt.Equals, http.StatusNotFound)
+}
+
+// waitFor waits for cond to become true, failing the test if it takes more than a few seconds.
+func waitFor(c *qt.C, cond func() bool) {
+	c.Helper()
+	for start := time.Now(); !cond(); time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			c.Fatal("timed out waiting for condition")
+		}
+	}
+}
+
+func TestSubscriptionConfig_Backoff(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	cfg := SubscriptionConfig{MinBackoff: time.Second, MaxBackoff: 5 * time.Second}.withDefaults()
+	var backoffs []string
+	for attempt := 1; attempt <= 5; attempt++ {
+		backoffs = append(backoffs, cfg.backoff(attempt).String())
+	}
+	c.Assert(strings.Join(backoffs, " "), qt.Equals, "1s 2s 4s 5s 5s")
+}
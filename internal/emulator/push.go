@@ -0,0 +1,216 @@
+package emulator
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/clock"
+
+	"go.encore.dev/platform-sdk/encorecloud"
+	"go.encore.dev/platform-sdk/encorecloud/types"
+	"go.encore.dev/platform-sdk/pkg/auth"
+)
+
+// errAckDeadlineExceeded is returned when a push goes longer than the
+// ack deadline without receiving an event.
+var errAckDeadlineExceeded = errors.New("ack deadline exceeded")
+
+// nackError is returned when a subscription nacks a message.
+type nackError struct {
+	nack types.SubscriptionNack
+}
+
+func (e *nackError) Error() string {
+	return "nacked: " + e.nack.Error
+}
+
+// errNoResult is the result of a message the push response ended without an event for.
+var errNoResult = errors.New("push response ended without an ack or nack")
+
+// errVersionNotAcceptable is returned when the push endpoint doesn't support the push version requested.
+var errVersionNotAcceptable = errors.New("push version not acceptable")
+
+// push sends a signed push request for the messages to the subscription using the given push
+// version, and reads the event stream it responds with. Versions before 3 push a single message at
+// a time, and accept any version up to the given one in response. It returns the result of each
+// message, which is nil if it was acknowledged.
+func (e *Emulator) push(sub *subscription, version int, batch []pushed) []error {
+	msgs := make([]*types.SubscriptionPushParams, len(batch))
+	for i, p := range batch {
+		msgs[i] = &types.SubscriptionPushParams{
+			Data:            p.q.msg.Data,
+			Attributes:      p.q.msg.Attributes,
+			MessageID:       p.q.msg.ID,
+			PublishTime:     p.q.msg.PublishTime,
+			DeliveryAttempt: p.attempt,
+		}
+	}
+
+	results := make([]error, len(batch))
+	settled := make([]bool, len(batch))
+	settle := func(msgID string, err error) {
+		for i, msg := range msgs {
+			if !settled[i] && (msgID == msg.MessageID || version < 3) {
+				results[i], settled[i] = err, true
+				return
+			}
+		}
+	}
+
+	err := e.sendPush(sub, version, msgs, settle)
+	if err == nil {
+		err = errNoResult
+	}
+	for i := range results {
+		if !settled[i] {
+			results[i] = err
+		}
+	}
+	return results
+}
+
+// sendPush sends the push request and reads the results from its event stream, passing them to settle.
+func (e *Emulator) sendPush(sub *subscription, version int, msgs []*types.SubscriptionPushParams, settle func(msgID string, err error)) error {
+	var params auth.Payload = &types.SubscriptionPushBatchParams{Messages: msgs}
+	if version < 3 {
+		params = msgs[0]
+	}
+	opHash, err := auth.NewOperationHash(auth.PubsubMsg, auth.Read, params, []byte(sub.id))
+	if err != nil {
+		return fmt.Errorf("failed to hash push request: %w", err)
+	}
+	body, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to encode push request: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(e.ctx)
+	defer cancel()
+
+	// Fail the push if the subscription doesn't respond within the ack deadline,
+	// which is extended every time it sends an event
+	deadline := time.AfterFunc(sub.cfg.AckDeadline, cancel)
+	defer deadline.Stop()
+	extend := func() { deadline.Reset(sub.cfg.AckDeadline) }
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.cfg.PushEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create push request: %w", err)
+	}
+	headers := auth.Sign(&e.latestKey, e.cfg.AppSlug, e.cfg.EnvName, clock.New(), opHash)
+	req.Header.Set("Authorization", headers.Authorization)
+	req.Header.Set("Date", headers.Date)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(encorecloud.PushVersionAcceptHeader, acceptedVersions(version))
+
+	err = e.readPush(req, version, extend, settle)
+	if err != nil && ctx.Err() != nil && e.ctx.Err() == nil {
+		return errAckDeadlineExceeded
+	}
+	return err
+}
+
+// readPush sends the push request and reads the results from its event stream.
+func (e *Emulator) readPush(req *http.Request, version int, extend func(), settle func(msgID string, err error)) error {
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("push request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		err = fmt.Errorf("push request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+		if resp.StatusCode == http.StatusNotAcceptable {
+			err = fmt.Errorf("%w: %v", errVersionNotAcceptable, err)
+		}
+		return err
+	}
+	got := resp.Header.Get(encorecloud.PushVersionHeader)
+	respVersion, err := strconv.Atoi(got)
+	if err != nil || respVersion < 1 || respVersion > version || (version >= 3 && respVersion != version) {
+		return fmt.Errorf("push endpoint responded with push version %q, which was not requested", got)
+	}
+	extend()
+	return readPushResult(resp.Body, respVersion, extend, settle)
+}
+
+// acceptedVersions returns the push versions a push request using the given version accepts in response.
+// As a batch can only be pushed with version 3, a request pushing one accepts no other version.
+func acceptedVersions(version int) string {
+	if version >= 3 {
+		return strconv.Itoa(version)
+	}
+	versions := make([]string, version)
+	for i := range versions {
+		versions[i] = strconv.Itoa(i + 1)
+	}
+	return strings.Join(versions, ", ")
+}
+
+// readPushResult reads the server-sent event stream of a push response using the given
+// push version until it ends, calling extend for every event received and settle for every
+// message acked (with a nil error) or nacked (with a *nackError).
+//
+// Before push version 3 the events don't identify the message, as there is only one,
+// so settle is called with an empty message ID, and in version 1 the data of a nack
+// event is the error message rather than a JSON encoded [types.SubscriptionNack].
+func readPushResult(r io.Reader, version int, extend func(), settle func(msgID string, err error)) error {
+	var event string
+	var data []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		case line == "":
+			extend()
+			payload := strings.Join(data, "\n")
+			switch {
+			case version < 3 && event == "ack":
+				settle("", nil)
+				return nil
+			case version < 2 && event == "nack":
+				settle("", &nackError{nack: types.SubscriptionNack{Error: payload}})
+				return nil
+			case version < 3 && event == "nack":
+				var nack types.SubscriptionNack
+				if err := json.Unmarshal([]byte(payload), &nack); err != nil {
+					return fmt.Errorf("invalid nack event: %w", err)
+				}
+				settle("", &nackError{nack: nack})
+				return nil
+			case event == "ack":
+				var ack types.SubscriptionAck
+				if err := json.Unmarshal([]byte(payload), &ack); err != nil {
+					return fmt.Errorf("invalid ack event: %w", err)
+				}
+				settle(ack.MessageID, nil)
+			case event == "nack":
+				var nack types.SubscriptionNack
+				if err := json.Unmarshal([]byte(payload), &nack); err != nil {
+					return fmt.Errorf("invalid nack event: %w", err)
+				}
+				settle(nack.MessageID, &nackError{nack: nack})
+			}
+			event, data = "", nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read push response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package emulator
+
+import (
+	"errors"
+	"time"
+)
+
+// subscription is the state of a subscription.
+type subscription struct {
+	e     *Emulator
+	id    string
+	topic string
+	cfg   SubscriptionConfig
+	wake  chan struct{} // signalled when the queue may have messages ready to push
+
+	// The remaining fields are guarded by e.mu
+	queue       []*queued // the messages not yet acked or dead lettered, in the order they were published
+	unbatched   bool      // whether the push endpoint only supports push versions without batches
+	acked       int
+	deadLetters []*Message
+	deliveries  []Delivery
+}
+
+// queued is a message queued for a subscription.
+type queued struct {
+	msg       *Message
+	attempts  int       // the number of delivery attempts started
+	inFlight  bool      // whether the message is being pushed
+	notBefore time.Time // when the message may next be pushed
+}
+
+// pushed is a delivery attempt of a queued message.
+type pushed struct {
+	q       *queued
+	attempt int
+}
+
+// enqueueLocked queues the message to be pushed, the caller must hold e.mu.
+func (s *subscription) enqueueLocked(msg *Message) {
+	q := &queued{msg: msg}
+	if msg.DeliverAt != nil {
+		q.notBefore = *msg.DeliverAt
+	}
+	s.queue = append(s.queue, q)
+	s.e.unsettled++
+	s.signal()
+}
+
+// signal wakes up the dispatcher.
+func (s *subscription) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch pushes the queued messages until the emulator is closed.
+func (s *subscription) dispatch() {
+	defer s.e.running.Done()
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		next := s.startReady()
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if !next.IsZero() {
+			timer.Reset(time.Until(next))
+		}
+
+		select {
+		case <-s.wake:
+		case <-timer.C:
+		case <-s.e.ctx.Done():
+			return
+		}
+	}
+}
+
+// startReady starts pushing the queued messages which are ready, returning
+// when the next message which isn't yet ready will be (or zero if none are waiting).
+//
+// The messages are pushed in batches of up to MaxBatchSize using push version 3,
+// unless the push endpoint only supports earlier versions which push one message at a time.
+func (s *subscription) startReady() (next time.Time) {
+	s.e.mu.Lock()
+	defer s.e.mu.Unlock()
+
+	now := time.Now()
+	inFlight := 0
+	for _, q := range s.queue {
+		if q.inFlight {
+			inFlight++
+		}
+	}
+
+	// Only the oldest message for each ordering key may be pushed,
+	// so that they are delivered in the order they were published.
+	// This also ensures a batch never has two messages with the same key.
+	var ready []pushed
+	blockedKeys := make(map[string]bool)
+queue:
+	for _, q := range s.queue {
+		if key := q.msg.OrderingKey; key != "" {
+			if blockedKeys[key] {
+				continue
+			}
+			blockedKeys[key] = true
+		}
+
+		switch {
+		case q.inFlight:
+			continue
+		case q.notBefore.After(now):
+			if next.IsZero() || q.notBefore.Before(next) {
+				next = q.notBefore
+			}
+			continue
+		case inFlight >= s.cfg.MaxInFlight:
+			break queue
+		}
+
+		q.inFlight = true
+		q.attempts++
+		inFlight++
+		ready = append(ready, pushed{q: q, attempt: q.attempts})
+	}
+
+	version, batchSize := 3, s.cfg.MaxBatchSize
+	if s.unbatched {
+		version, batchSize = 2, 1
+	}
+	for len(ready) > 0 {
+		n := batchSize
+		if n > len(ready) {
+			n = len(ready)
+		}
+		s.e.running.Add(1)
+		go s.deliver(version, ready[:n])
+		ready = ready[n:]
+	}
+	return next
+}
+
+// deliver pushes the messages using up to the given push version and records their results.
+func (s *subscription) deliver(version int, batch []pushed) {
+	defer s.e.running.Done()
+
+	results := s.e.push(s, version, batch)
+	if s.e.ctx.Err() != nil {
+		// The emulator was closed
+		return
+	}
+
+	s.e.mu.Lock()
+	defer s.e.mu.Unlock()
+
+	if version >= 3 && errors.Is(results[0], errVersionNotAcceptable) {
+		// Fall back to pushing one message at a time, pushing the messages again without counting this attempt
+		s.e.logger.Info("push endpoint does not support push version 3, falling back to unbatched pushes", "subscription", s.id)
+		s.unbatched = true
+		for _, p := range batch {
+			p.q.inFlight = false
+			p.q.attempts--
+		}
+		s.signal()
+		return
+	}
+
+	for i, p := range batch {
+		s.settleLocked(p.q, p.attempt, results[i])
+	}
+	s.signal()
+}
+
+// settleLocked records the result of an attempt to push the message, acking it, dead lettering it
+// or scheduling its redelivery. The caller must hold e.mu.
+func (s *subscription) settleLocked(q *queued, attempt int, err error) {
+	if err != nil {
+		s.e.logger.Info("push failed", "subscription", s.id, "message_id", q.msg.ID, "attempt", attempt, "error", err)
+	}
+
+	delivery := Delivery{Subscription: s.id, MessageID: q.msg.ID, Attempt: attempt, Acked: err == nil, Time: time.Now()}
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+	s.deliveries = append(s.deliveries, delivery)
+
+	var nack *nackError
+	errors.As(err, &nack)
+
+	q.inFlight = false
+	switch {
+	case err == nil:
+		s.acked++
+		s.removeLocked(q)
+	case attempt >= s.cfg.MaxDeliveryAttempts || (nack != nil && nack.nack.Permanent):
+		s.e.logger.Warn("dead lettering message", "subscription", s.id, "message_id", q.msg.ID, "attempts", attempt)
+		s.deadLetters = append(s.deadLetters, q.msg)
+		s.removeLocked(q)
+	case nack != nil && nack.nack.RetryAfterMillis > 0:
+		q.notBefore = time.Now().Add(time.Duration(nack.nack.RetryAfterMillis) * time.Millisecond)
+	default:
+		q.notBefore = time.Now().Add(s.cfg.backoff(attempt))
+	}
+}
+
+// removeLocked removes a settled message from the queue, the caller must hold e.mu.
+func (s *subscription) removeLocked(q *queued) {
+	for i, other := range s.queue {
+		if other == q {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			s.e.settledLocked(1)
+			return
+		}
+	}
+}
+
+// purgeLocked removes the queued messages which are not being pushed,
+// returning how many were removed. The caller must hold e.mu.
+func (s *subscription) purgeLocked() int {
+	kept := s.queue[:0]
+	for _, q := range s.queue {
+		if q.inFlight {
+			kept = append(kept, q)
+		}
+	}
+	purged := len(s.queue) - len(kept)
+	for i := len(kept); i < len(s.queue); i++ {
+		s.queue[i] = nil
+	}
+	s.queue = kept
+	if purged > 0 {
+		s.e.settledLocked(purged)
+	}
+	return purged
+}
@@ -1,11 +1,97 @@
 package platform
 
 import (
+	"net/http"
+
 	"github.com/benbjohnson/clock"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
+
 	"go.encore.dev/platform-sdk/internal/client"
 	"go.encore.dev/platform-sdk/pkg/auth"
+	"go.encore.dev/platform-sdk/pkg/logging"
+	"go.encore.dev/platform-sdk/pkg/metrics"
+)
+
+// RetryPolicy configures how the SDK retries requests to the Encore Platform
+// which fail with a transient error.
+type RetryPolicy = client.RetryPolicy
+
+// DefaultRetryPolicy returns the retry policy the SDK uses unless
+// [WithRetryPolicy] is given.
+func DefaultRetryPolicy() RetryPolicy {
+	return client.DefaultRetryPolicy()
+}
+
+// Operation describes the operation a request to the Encore Platform is performing.
+type Operation = client.Operation
+
+// Invoker sends a request to the Encore Platform, see [Interceptor].
+type Invoker = client.Invoker
+
+// Interceptor intercepts every request the SDK makes to the Encore Platform.
+//
+// Interceptors can be used to add cross-cutting behaviour such as logging, metrics,
+// additional headers or to replace the Encore Platform with a fake in tests.
+type Interceptor = client.Interceptor
+
+// LoggingInterceptor returns an [Interceptor] which logs every request made
+// to the Encore Platform using the given logger.
+//
+// To log through any other logger, use [WithLogger] instead.
+func LoggingInterceptor(logger *zerolog.Logger) Interceptor {
+	return client.LoggingInterceptor(logging.Zerolog(logger))
+}
+
+// Compression is a content encoding the SDK can use to compress request bodies.
+type Compression = client.Compression
+
+const (
+	GzipCompression = client.GzipCompression // Compress request bodies using gzip
+	ZstdCompression = client.ZstdCompression // Compress request bodies using Zstandard
+)
+
+// CircuitBreakerConfig configures the circuit breakers the SDK keeps for each
+// operation it performs against the Encore Platform, see [WithCircuitBreaker].
+type CircuitBreakerConfig = client.CircuitBreakerConfig
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState = client.CircuitState
+
+// OperationKey identifies the operation a circuit breaker is tracking.
+type OperationKey = client.OperationKey
+
+// CircuitOpenError is the error returned when a request fails fast because
+// the circuit breaker for its operation is open.
+type CircuitOpenError = client.CircuitOpenError
+
+const (
+	CircuitClosed   = client.CircuitClosed   // Requests are sent as normal
+	CircuitOpen     = client.CircuitOpen     // Requests fail fast without being sent
+	CircuitHalfOpen = client.CircuitHalfOpen // Trial requests are sent to test if the platform has recovered
 )
 
+// ErrCircuitOpen is returned when a request is not sent because the circuit breaker for
+// its operation is open. It can be detected using [errors.Is].
+var ErrCircuitOpen = client.ErrCircuitOpen // nolint: gochecknoglobals
+
+// RateLimit is a token bucket rate limit, see [WithRateLimit].
+type RateLimit = client.RateLimit
+
+// RateLimitConfig configures the client-side rate limits the SDK applies
+// to requests made to the Encore Platform, see [WithRateLimit].
+type RateLimitConfig = client.RateLimitConfig
+
+// RateLimitedError is the error returned when a request is not sent because of the rate limit.
+type RateLimitedError = client.RateLimitedError
+
+// ErrRateLimited is returned when a request is not sent because it would exceed the
+// configured rate limit and the caller asked not to wait. It can be detected using [errors.Is].
+var ErrRateLimited = client.ErrRateLimited // nolint: gochecknoglobals
+
+// FailoverConfig configures the Encore Platform endpoints the SDK fails over between, see [WithFailover].
+type FailoverConfig = client.FailoverConfig
+
 // Option is a function that can be passed to New to configure the SDK.
 type Option func(config *client.Config)
 
@@ -49,3 +135,125 @@ func WithClock(clock clock.Clock) Option {
 		config.Clock = clock
 	}
 }
+
+// WithRetryPolicy configures how the SDK retries requests which fail with a transient error.
+//
+// To disable retries pass a policy with MaxAttempts set to 1.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(config *client.Config) {
+		config.Retry = policy
+	}
+}
+
+// WithInterceptors adds the given interceptors to the chain called for every request
+// made to the Encore Platform.
+//
+// Interceptors are called in the order given, with the first being the outermost. They
+// wrap the SDK's built-in retry behaviour, so they are called once per request no matter
+// how many attempts are needed to complete it.
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(config *client.Config) {
+		config.Interceptors = append(config.Interceptors, interceptors...)
+	}
+}
+
+// WithTracerProvider configures the SDK to record OpenTelemetry spans using the given
+// tracer provider, for both requests made to the Encore Platform and push subscription
+// messages received from it.
+//
+// When enabled, the trace context is propagated through published messages using the
+// W3C traceparent and tracestate message attributes, so that the subscriber handling
+// a message is part of the same trace as the request which published it.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(config *client.Config) {
+		config.TracerProvider = tp
+	}
+}
+
+// WithMetrics configures the SDK to record metrics about the requests it makes to the
+// Encore Platform and the PubSub messages it publishes and handles.
+//
+// Use [metrics.NewRegistry] for an implementation which can be scraped by Prometheus.
+func WithMetrics(m metrics.Metrics) Option {
+	return func(config *client.Config) {
+		config.Metrics = m
+	}
+}
+
+// WithCompression configures the SDK to compress request bodies sent to the Encore Platform
+// using the given compression, once the platform has advertised that it supports it.
+//
+// Compressed responses from the Encore Platform and compressed push requests are always
+// accepted, regardless of this option.
+func WithCompression(compression Compression) Option {
+	return func(config *client.Config) {
+		config.Compression = compression
+	}
+}
+
+// WithCircuitBreaker configures the SDK to use a circuit breaker for each operation it
+// performs against the Encore Platform, such that while the platform is failing requests
+// for an operation further requests fail fast with [ErrCircuitOpen] rather than waiting
+// for their context to time out.
+func WithCircuitBreaker(cfg CircuitBreakerConfig) Option {
+	return func(config *client.Config) {
+		config.CircuitBreaker = &cfg
+	}
+}
+
+// WithRateLimit configures the SDK to limit the rate of requests it makes to the
+// Encore Platform, both globally and per operation.
+//
+// The limits adapt to the Encore Platform throttling requests, pausing for any
+// Retry-After duration it requests and reducing the rate until requests succeed again.
+func WithRateLimit(cfg RateLimitConfig) Option {
+	return func(config *client.Config) {
+		config.RateLimit = &cfg
+	}
+}
+
+// WithFailover configures the SDK to send requests to whichever of the given Encore Platform
+// endpoints is healthy and has the lowest latency, failing over to the next endpoint when one
+// fails a request with a network error or a 5xx response.
+//
+// The first endpoint is used as the host, overriding any given by [WithHost]. Endpoints are
+// only health checked in the background if a health check path is configured, in which case
+// [SDK.Close] should be called to stop the health checks once the SDK is no longer needed.
+func WithFailover(cfg FailoverConfig) Option {
+	return func(config *client.Config) {
+		cfg.Endpoints = append([]string(nil), cfg.Endpoints...)
+		if len(cfg.Endpoints) > 0 {
+			config.Host = cfg.Endpoints[0]
+		}
+		config.Failover = &cfg
+	}
+}
+
+// WithLogger configures the SDK to log to the given logger, which is used by both the
+// client and the subscription handlers.
+//
+// A *slog.Logger can be passed as is, and a zerolog logger can be adapted using
+// [logging.Zerolog]. Every attempt to send a request to the Encore Platform is logged at
+// debug level, without any of its headers or body, so secrets are never logged.
+func WithLogger(logger logging.Logger) Option {
+	return func(config *client.Config) {
+		config.Logger = logger
+	}
+}
+
+// WithTransport configures the SDK to send requests to the Encore Platform using the given
+// transport, rather than [http.DefaultTransport].
+func WithTransport(transport http.RoundTripper) Option {
+	return func(config *client.Config) {
+		config.Transport = transport
+	}
+}
+
+// WithMaxRequestBodySize configures the maximum size of a request body the SDK accepts from the
+// Encore Platform once it has been decompressed, such as a push to a subscription handler,
+// overriding the default of 32 MiB. Larger requests are rejected with 413 Request Entity Too Large.
+func WithMaxRequestBodySize(size int64) Option {
+	return func(config *client.Config) {
+		config.MaxRequestBodySize = size
+	}
+}
@@ -16,6 +16,7 @@ type ObjectType string
 
 const (
 	PubsubMsg ObjectType = "pubsub-msg"
+	Ping      ObjectType = "ping"
 )
 
 type ActionType string
@@ -55,3 +55,18 @@ func TestNewOperationHash(t *testing.T) {
 		})
 	}
 }
+
+func TestWithBodyDigest(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	hash := func(payload Payload, body string) OperationHash {
+		h, err := NewOperationHash(PubsubMsg, Update, WithBodyDigest(payload, []byte(body)))
+		c.Assert(err, qt.IsNil)
+		return h
+	}
+
+	c.Assert(hash(nil, "raw data"), qt.Equals, hash(nil, "raw data"))
+	c.Assert(hash(nil, "raw data"), qt.Not(qt.Equals), hash(nil, "tampered"), qt.Commentf("the body should be covered by the hash"))
+	c.Assert(hash(BytesPayload("a"), "raw data"), qt.Not(qt.Equals), hash(BytesPayload("b"), "raw data"), qt.Commentf("the payload should be covered by the hash"))
+}
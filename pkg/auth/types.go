@@ -1,5 +1,7 @@
 package auth
 
+import "crypto/sha256"
+
 // Key is a MAC key for authenticating communication between
 // an Encore app and the Encore Platform. It is designed to be
 // JSON marshalable, but as it contains secret material care
@@ -20,3 +22,15 @@ type BytesPayload []byte
 func (b BytesPayload) DeterministicBytes() []byte {
 	return b
 }
+
+// WithBodyDigest returns a payload made of the deterministic bytes of payload (if it is not nil)
+// followed by the SHA-256 digest of body, so that an operation hash computed over it
+// authenticates a raw request body which is sent instead of a JSON encoded payload.
+func WithBodyDigest(payload Payload, body []byte) Payload {
+	var b []byte
+	if payload != nil {
+		b = append(b, payload.DeterministicBytes()...)
+	}
+	digest := sha256.Sum256(body)
+	return BytesPayload(append(b, digest[:]...))
+}
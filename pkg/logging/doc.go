@@ -0,0 +1,8 @@
+// Package logging provides the minimal structured logging interface the SDK logs through.
+//
+// The [Logger] interface has the same shape as the methods of *slog.Logger, so a *slog.Logger
+// (from log/slog or golang.org/x/exp/slog) can be used as is. Other logging libraries can be
+// adapted to it, such as zerolog using [Zerolog].
+//
+// The SDK never logs secrets such as auth keys, signatures or message payloads.
+package logging
@@ -0,0 +1,39 @@
+package logging
+
+// Logger is a structured logger.
+//
+// Each method logs msg at its level, with args being alternating keys and values
+// in the style of log/slog, for example:
+//
+//	logger.Warn("request failed", "path", path, "error", err)
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// Discard is a [Logger] which discards everything logged to it.
+type Discard struct{}
+
+func (Discard) Debug(string, ...any) {}
+func (Discard) Info(string, ...any)  {}
+func (Discard) Warn(string, ...any)  {}
+func (Discard) Error(string, ...any) {}
+
+// badKey is the key used for a value with no key, matching log/slog.
+const badKey = "!BADKEY"
+
+// pairs calls fn for each key and value in args.
+func pairs(args []any, fn func(key string, value any)) {
+	for len(args) > 0 {
+		key, ok := args[0].(string)
+		if !ok || len(args) == 1 {
+			fn(badKey, args[0])
+			args = args[1:]
+			continue
+		}
+		fn(key, args[1])
+		args = args[2:]
+	}
+}
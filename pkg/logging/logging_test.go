@@ -0,0 +1,59 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/rs/zerolog"
+)
+
+func TestZerolog(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		log  func(l Logger)
+		want string
+	}{
+		{
+			name: "key values",
+			log:  func(l Logger) { l.Info("hello", "count", 2, "path", "/v1/ping", "duration", time.Second) },
+			want: `{"level":"info","count":2,"path":"/v1/ping","duration":1000000000,"message":"hello"}`,
+		},
+		{
+			name: "errors",
+			log:  func(l Logger) { l.Error("failed", "error", errors.New("boom")) },
+			want: `{"level":"error","error":"boom","message":"failed"}`,
+		},
+		{
+			name: "missing keys",
+			log:  func(l Logger) { l.Warn("odd", 42, "key", "value", "dangling") },
+			want: `{"level":"warn","!BADKEY":42,"key":"value","!BADKEY":"dangling","message":"odd"}`,
+		},
+		{
+			name: "disabled level",
+			log:  func(l Logger) { l.Debug("quiet", "key", "value") },
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := qt.New(t)
+
+			var buf bytes.Buffer
+			logger := zerolog.New(&buf).Level(zerolog.InfoLevel)
+			tt.log(Zerolog(&logger))
+
+			if tt.want == "" {
+				c.Assert(buf.String(), qt.Equals, "")
+			} else {
+				c.Assert(buf.String(), qt.Equals, tt.want+"\n")
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package logging
+
+import (
+	"github.com/rs/zerolog"
+)
+
+// Zerolog adapts a zerolog logger to a [Logger].
+//
+// Values which are errors are logged using the logger's error marshaller,
+// all other values are logged using their JSON encoding.
+func Zerolog(logger *zerolog.Logger) Logger {
+	return zerologLogger{logger}
+}
+
+type zerologLogger struct {
+	logger *zerolog.Logger
+}
+
+func (l zerologLogger) Debug(msg string, args ...any) { log(l.logger.Debug(), msg, args) }
+func (l zerologLogger) Info(msg string, args ...any)  { log(l.logger.Info(), msg, args) }
+func (l zerologLogger) Warn(msg string, args ...any)  { log(l.logger.Warn(), msg, args) }
+func (l zerologLogger) Error(msg string, args ...any) { log(l.logger.Error(), msg, args) }
+
+func log(event *zerolog.Event, msg string, args []any) {
+	if event == nil {
+		// The level is disabled
+		return
+	}
+	pairs(args, func(key string, value any) {
+		if err, ok := value.(error); ok {
+			event.AnErr(key, err)
+		} else {
+			event.Interface(key, value)
+		}
+	})
+	event.Msg(msg)
+}
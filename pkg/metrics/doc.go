@@ -0,0 +1,7 @@
+// Package metrics provides a way for Encore applications to observe the requests the SDK makes
+// to the Encore Platform and the PubSub messages it publishes and handles.
+//
+// The SDK reports what it observes to a [Metrics] implementation, which can be adapted to any
+// metrics system. The [Registry] implementation keeps the metrics in memory and exposes them
+// using the Prometheus text exposition format.
+package metrics
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"time"
+)
+
+// Outcome describes the result of an operation observed by the SDK.
+type Outcome string
+
+const (
+	Success      Outcome = "success"       // The operation completed successfully
+	Throttled    Outcome = "throttled"     // The request was rate limited, either by the Encore Platform or the SDK
+	ClientError  Outcome = "client_error"  // The Encore Platform rejected the request with a 4xx status code
+	ServerError  Outcome = "server_error"  // The Encore Platform failed the request with a 5xx status code
+	NetworkError Outcome = "network_error" // The request failed before a response was received
+	Cancelled    Outcome = "cancelled"     // The context of the operation was cancelled or its deadline exceeded
+	Ack          Outcome = "ack"           // A pushed message was processed successfully and acknowledged
+	Nack         Outcome = "nack"          // A pushed message failed to be processed and will be retried
+)
+
+// Metrics receives the observations made by the SDK.
+//
+// Implementations must be safe for concurrent use.
+type Metrics interface {
+	// ObserveRequest is called after each request to the Encore Platform completes,
+	// including any retries that were required.
+	ObserveRequest(object, action string, outcome Outcome, duration time.Duration)
+
+	// ObservePublish is called after each attempt to publish a message to a topic completes.
+	ObservePublish(topic string, outcome Outcome, duration time.Duration)
+
+	// ObservePush is called after the subscription callback for a pushed message completes.
+	//
+	// The lag is the time between the message being published and the callback starting.
+	ObservePush(subscription string, outcome Outcome, duration time.Duration, deliveryAttempt int, lag time.Duration)
+}
+
+// Discard is a [Metrics] implementation which discards all observations.
+type Discard struct{}
+
+var _ Metrics = Discard{}
+
+func (Discard) ObserveRequest(string, string, Outcome, time.Duration)          {}
+func (Discard) ObservePublish(string, Outcome, time.Duration)                  {}
+func (Discard) ObservePush(string, Outcome, time.Duration, int, time.Duration) {}
@@ -0,0 +1,242 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	counterType   = "counter"
+	histogramType = "histogram"
+)
+
+// Registry is an in-memory [Metrics] implementation which exposes the observed
+// metrics using the Prometheus text exposition format, either by mounting it as an
+// [http.Handler] to be scraped or by calling [Registry.WriteTo] directly.
+//
+// The zero value is not usable, use [NewRegistry] to create a registry.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+var _ Metrics = (*Registry)(nil)
+var _ http.Handler = (*Registry)(nil)
+
+// NewRegistry creates a new registry containing all the metrics the SDK records.
+func NewRegistry() *Registry {
+	latencyBuckets := []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+	lagBuckets := []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 3600}
+	attemptBuckets := []float64{1, 2, 3, 5, 10, 20, 50, 100}
+
+	r := &Registry{families: make(map[string]*family)}
+	r.register("encore_platform_requests_total", "Total number of requests made to the Encore Platform.", counterType, nil, "object", "action", "outcome")
+	r.register("encore_platform_request_duration_seconds", "Duration of requests made to the Encore Platform, including retries.", histogramType, latencyBuckets, "object", "action", "outcome")
+	r.register("encore_pubsub_published_total", "Total number of messages published to topics.", counterType, nil, "topic", "outcome")
+	r.register("encore_pubsub_publish_duration_seconds", "Duration of publishing messages to topics.", histogramType, latencyBuckets, "topic", "outcome")
+	r.register("encore_pubsub_pushed_total", "Total number of pushed messages handled by subscriptions.", counterType, nil, "subscription", "outcome")
+	r.register("encore_pubsub_push_duration_seconds", "Duration of subscription callbacks handling pushed messages.", histogramType, latencyBuckets, "subscription", "outcome")
+	r.register("encore_pubsub_push_delivery_attempt", "Delivery attempt of pushed messages handled by subscriptions.", histogramType, attemptBuckets, "subscription")
+	r.register("encore_pubsub_push_lag_seconds", "Time between a message being published and its subscription callback starting.", histogramType, lagBuckets, "subscription")
+	return r
+}
+
+func (r *Registry) ObserveRequest(object, action string, outcome Outcome, duration time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.families["encore_platform_requests_total"].observe(1, object, action, string(outcome))
+	r.families["encore_platform_request_duration_seconds"].observe(duration.Seconds(), object, action, string(outcome))
+}
+
+func (r *Registry) ObservePublish(topic string, outcome Outcome, duration time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.families["encore_pubsub_published_total"].observe(1, topic, string(outcome))
+	r.families["encore_pubsub_publish_duration_seconds"].observe(duration.Seconds(), topic, string(outcome))
+}
+
+func (r *Registry) ObservePush(subscription string, outcome Outcome, duration time.Duration, deliveryAttempt int, lag time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.families["encore_pubsub_pushed_total"].observe(1, subscription, string(outcome))
+	r.families["encore_pubsub_push_duration_seconds"].observe(duration.Seconds(), subscription, string(outcome))
+	r.families["encore_pubsub_push_delivery_attempt"].observe(float64(deliveryAttempt), subscription)
+	r.families["encore_pubsub_push_lag_seconds"].observe(math.Max(lag.Seconds(), 0), subscription)
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = r.WriteTo(w)
+}
+
+// WriteTo writes the metrics to w in the Prometheus text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	for _, name := range names {
+		r.families[name].writeTo(cw)
+	}
+	if err := cw.w.Flush(); err != nil && cw.err == nil {
+		cw.err = err
+	}
+	return cw.n, cw.err
+}
+
+func (r *Registry) register(name, help, typ string, buckets []float64, labelNames ...string) {
+	r.families[name] = &family{
+		name:       name,
+		help:       help,
+		typ:        typ,
+		buckets:    buckets,
+		labelNames: labelNames,
+		series:     make(map[string]*series),
+	}
+}
+
+// family is a metric and all the series recorded for it.
+type family struct {
+	name       string
+	help       string
+	typ        string
+	buckets    []float64 // The upper bounds of the histogram buckets (histograms only)
+	labelNames []string
+	series     map[string]*series // keyed by the label values
+}
+
+// series is a single set of label values for a metric.
+type series struct {
+	labelValues  []string
+	value        float64  // The sum of all observations
+	count        uint64   // The number of observations (histograms only)
+	bucketCounts []uint64 // The number of observations in each bucket (histograms only)
+}
+
+func (f *family) observe(value float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	s, found := f.series[key]
+	if !found {
+		s = &series{labelValues: labelValues}
+		if f.typ == histogramType {
+			s.bucketCounts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+
+	s.value += value
+	if f.typ == histogramType {
+		s.count++
+		for i, bound := range f.buckets {
+			if value <= bound {
+				s.bucketCounts[i]++
+			}
+		}
+	}
+}
+
+func (f *family) writeTo(w *countingWriter) {
+	if len(f.series) == 0 {
+		return
+	}
+
+	w.printf("# HELP %s %s\n", f.name, f.help)
+	w.printf("# TYPE %s %s\n", f.name, f.typ)
+
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := f.series[key]
+		labels := f.labels(s.labelValues)
+
+		if f.typ == counterType {
+			w.printf("%s%s %s\n", f.name, labels, formatFloat(s.value))
+			continue
+		}
+
+		for i, bound := range f.buckets {
+			w.printf("%s_bucket%s %d\n", f.name, f.labels(s.labelValues, "le", formatFloat(bound)), s.bucketCounts[i])
+		}
+		w.printf("%s_bucket%s %d\n", f.name, f.labels(s.labelValues, "le", "+Inf"), s.count)
+		w.printf("%s_sum%s %s\n", f.name, labels, formatFloat(s.value))
+		w.printf("%s_count%s %d\n", f.name, labels, s.count)
+	}
+}
+
+// labels formats the label set for the given label values, with any extra
+// label name and value pairs appended.
+func (f *family) labels(values []string, extra ...string) string {
+	if len(values) == 0 && len(extra) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, value := range values {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(f.labelNames[i])
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(value))
+		b.WriteByte('"')
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		b.WriteString(extra[i])
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(extra[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// countingWriter is a writer which tracks the number of bytes written
+// and the first error encountered.
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (w *countingWriter) printf(format string, args ...any) {
+	if w.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(w.w, format, args...)
+	w.n += int64(n)
+	w.err = err
+}
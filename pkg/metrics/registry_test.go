@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	r := NewRegistry()
+
+	// Nothing is written until something is observed
+	var b strings.Builder
+	_, err := r.WriteTo(&b)
+	c.Assert(err, qt.IsNil)
+	c.Assert(b.String(), qt.Equals, "")
+
+	r.ObservePublish("orders", Success, 20*time.Millisecond)
+	r.ObservePublish("orders", Success, 200*time.Millisecond)
+	r.ObservePublish(`weird"topic`, Throttled, time.Second)
+	r.ObservePush("orders-sub", Nack, 3*time.Second, 4, 2*time.Minute)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	c.Assert(rec.Header().Get("Content-Type"), qt.Equals, "text/plain; version=0.0.4; charset=utf-8")
+	out := rec.Body.String()
+
+	for _, want := range []string{
+		"# TYPE encore_pubsub_published_total counter\n",
+		`encore_pubsub_published_total{topic="orders",outcome="success"} 2` + "\n",
+		`encore_pubsub_published_total{topic="weird\"topic",outcome="throttled"} 1` + "\n",
+		"# TYPE encore_pubsub_publish_duration_seconds histogram\n",
+		`encore_pubsub_publish_duration_seconds_bucket{topic="orders",outcome="success",le="0.01"} 0` + "\n",
+		`encore_pubsub_publish_duration_seconds_bucket{topic="orders",outcome="success",le="0.025"} 1` + "\n",
+		`encore_pubsub_publish_duration_seconds_bucket{topic="orders",outcome="success",le="0.25"} 2` + "\n",
+		`encore_pubsub_publish_duration_seconds_bucket{topic="orders",outcome="success",le="+Inf"} 2` + "\n",
+		`encore_pubsub_publish_duration_seconds_sum{topic="orders",outcome="success"} 0.22` + "\n",
+		`encore_pubsub_publish_duration_seconds_count{topic="orders",outcome="success"} 2` + "\n",
+		`encore_pubsub_pushed_total{subscription="orders-sub",outcome="nack"} 1` + "\n",
+		`encore_pubsub_push_delivery_attempt_bucket{subscription="orders-sub",le="3"} 0` + "\n",
+		`encore_pubsub_push_delivery_attempt_bucket{subscription="orders-sub",le="5"} 1` + "\n",
+		`encore_pubsub_push_lag_seconds_sum{subscription="orders-sub"} 120` + "\n",
+	} {
+		c.Assert(out, qt.Contains, want)
+	}
+	c.Assert(out, qt.Not(qt.Contains), "encore_platform_requests_total", qt.Commentf("unobserved metrics should not be written"))
+}
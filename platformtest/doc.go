@@ -0,0 +1,19 @@
+// Package platformtest provides an in-process fake of Encore Cloud for integration tests.
+//
+// The fake [Server] implements the Encore Cloud PubSub API, verifying the signatures of the
+// requests it receives using the same auth package as the real platform. Published messages
+// are stored in memory and pushed to the registered subscription handlers using the real signed
+// push protocol, redelivering them when the handler fails, so that code using the SDK can be
+// tested end to end:
+//
+//	srv := platformtest.NewServer(platformtest.Config{})
+//	defer srv.Close()
+//
+//	sdk := platform.NewSDK(srv.Options()...)
+//	srv.Subscribe("my-topic", "my-subscription", sdk.EncoreCloud.CreateSubscriptionHandler("my-subscription", nil, handle))
+//
+//	_, err := sdk.EncoreCloud.PublishToTopic(ctx, "my-topic", "", nil, []byte(`{"hello":"world"}`))
+//	...
+//	err = srv.Wait(ctx) // wait for the message to be delivered
+//	deliveries := srv.Deliveries("my-subscription")
+package platformtest
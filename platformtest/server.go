@@ -0,0 +1,213 @@
+package platformtest
+
+import (
+	"context"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	platform "go.encore.dev/platform-sdk"
+	"go.encore.dev/platform-sdk/internal/emulator"
+	"go.encore.dev/platform-sdk/pkg/auth"
+)
+
+// Config configures a [Server].
+type Config struct {
+	AppSlug             string        // The app slug requests are signed for (defaults to "test-app")
+	EnvName             string        // The environment name requests are signed for (defaults to "test-env")
+	Keys                []auth.Key    // The auth keys shared with the SDK (defaults to a single random key)
+	MaxDeliveryAttempts int           // The number of times a message is pushed to a subscription before giving up (defaults to 5)
+	RedeliveryDelay     time.Duration // How long to wait before pushing a message again after it failed (defaults to 10ms)
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.AppSlug == "" {
+		cfg.AppSlug = "test-app"
+	}
+	if cfg.EnvName == "" {
+		cfg.EnvName = "test-env"
+	}
+	if len(cfg.Keys) == 0 {
+		data := make([]byte, 32)
+		_, _ = rand.Read(data)
+		cfg.Keys = []auth.Key{{KeyID: 1, Data: data}}
+	}
+	if cfg.MaxDeliveryAttempts <= 0 {
+		cfg.MaxDeliveryAttempts = 5
+	}
+	if cfg.RedeliveryDelay <= 0 {
+		cfg.RedeliveryDelay = 10 * time.Millisecond
+	}
+	return cfg
+}
+
+// Message is a message published to the [Server].
+type Message struct {
+	ID          string
+	Topic       string
+	OrderingKey string
+	Attributes  map[string]string
+	Data        []byte
+	PublishTime time.Time
+	DeliverAt   time.Time // When the message is first delivered, if it was delayed
+
+	DeduplicationID string
+}
+
+// Delivery is an attempt to push a message to a subscription.
+type Delivery struct {
+	Subscription string
+	MessageID    string
+	Attempt      int    // The delivery attempt, starting at 1
+	Acked        bool   // Whether the subscription acknowledged the message
+	Error        string // Why the delivery failed, if it was not acknowledged
+}
+
+// Server is a fake Encore Cloud running in-process.
+type Server struct {
+	cfg      Config
+	emulator *emulator.Emulator
+	srv      *httptest.Server
+
+	mu              sync.Mutex
+	subServers      []*httptest.Server
+	publishFailures []int // the statuses to fail the next publishes with
+}
+
+// NewServer starts a new fake Encore Cloud, which must be closed once the test is done.
+func NewServer(cfg Config) *Server {
+	cfg = cfg.withDefaults()
+	s := &Server{cfg: cfg}
+	s.emulator = emulator.New(emulator.Config{
+		AppSlug:          cfg.AppSlug,
+		EnvName:          cfg.EnvName,
+		Keys:             cfg.Keys,
+		AutoCreateTopics: true,
+	})
+	s.emulator.SetPublishHook(s.failPublish)
+	s.srv = httptest.NewServer(s.emulator)
+	return s
+}
+
+// URL returns the base URL of the server.
+func (s *Server) URL() string {
+	return s.srv.URL
+}
+
+// Keys returns the auth keys shared between the server and the SDK.
+func (s *Server) Keys() []auth.Key {
+	return s.cfg.Keys
+}
+
+// Options returns the options to configure an SDK to use the server.
+func (s *Server) Options() []platform.Option {
+	return []platform.Option{
+		platform.WithHost(s.URL()),
+		platform.WithAppDetails(s.cfg.AppSlug, s.cfg.EnvName),
+		platform.WithAuthKeys(s.cfg.Keys...),
+	}
+}
+
+// Close stops the server, abandoning any deliveries in progress.
+func (s *Server) Close() {
+	s.emulator.Close()
+	s.srv.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, srv := range s.subServers {
+		srv.Close()
+	}
+}
+
+// Subscribe registers the handler for a subscription to the topic, such that messages published
+// to the topic from now on are pushed to it. The handler is typically created using
+// [encorecloud.Client.CreateSubscriptionHandler], and is served over HTTP by the server.
+//
+// Messages with the same ordering key are pushed one at a time, in the order they were published.
+//
+// It panics if a subscription with the same ID has already been registered.
+func (s *Server) Subscribe(topicID, subscriptionID string, handler http.Handler) {
+	srv := httptest.NewServer(handler)
+	s.mu.Lock()
+	s.subServers = append(s.subServers, srv)
+	s.mu.Unlock()
+
+	err := s.emulator.Subscribe(topicID, subscriptionID, emulator.SubscriptionConfig{
+		PushEndpoint:        srv.URL,
+		MaxDeliveryAttempts: s.cfg.MaxDeliveryAttempts,
+		MinBackoff:          s.cfg.RedeliveryDelay,
+		MaxBackoff:          s.cfg.RedeliveryDelay,
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// FailPublishes makes the next n publish requests fail with the given status code,
+// for instance to test the SDK retries them.
+func (s *Server) FailPublishes(n int, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.publishFailures = append(s.publishFailures, status)
+	}
+}
+
+// failPublish is the publish hook of the emulator, which fails the publishes requested by FailPublishes.
+func (s *Server) failPublish(string) (status int, fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.publishFailures) == 0 {
+		return 0, false
+	}
+	status = s.publishFailures[0]
+	s.publishFailures = s.publishFailures[1:]
+	return status, true
+}
+
+// Published returns the messages published to the topic, in the order they were published.
+func (s *Server) Published(topicID string) []Message {
+	var messages []Message
+	for _, msg := range s.emulator.Published(topicID) {
+		message := Message{
+			ID:          msg.ID,
+			Topic:       msg.Topic,
+			OrderingKey: msg.OrderingKey,
+			Attributes:  msg.Attributes,
+			Data:        msg.Data,
+			PublishTime: msg.PublishTime,
+
+			DeduplicationID: msg.DeduplicationID,
+		}
+		if msg.DeliverAt != nil {
+			message.DeliverAt = *msg.DeliverAt
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+// Deliveries returns the attempts made to push messages to the subscription,
+// in the order they completed.
+func (s *Server) Deliveries(subscriptionID string) []Delivery {
+	var deliveries []Delivery
+	for _, delivery := range s.emulator.Deliveries(subscriptionID) {
+		deliveries = append(deliveries, Delivery{
+			Subscription: delivery.Subscription,
+			MessageID:    delivery.MessageID,
+			Attempt:      delivery.Attempt,
+			Acked:        delivery.Acked,
+			Error:        delivery.Error,
+		})
+	}
+	return deliveries
+}
+
+// Wait waits until every message published so far has either been acknowledged by each
+// of its subscriptions, or has run out of delivery attempts.
+func (s *Server) Wait(ctx context.Context) error {
+	return s.emulator.Wait(ctx) // nolint: wrapcheck
+}
@@ -0,0 +1,129 @@
+package platformtest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	platform "go.encore.dev/platform-sdk"
+	"go.encore.dev/platform-sdk/encorecloud"
+	"go.encore.dev/platform-sdk/pkg/auth"
+)
+
+func TestServer_PublishAndDeliver(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	srv := NewServer(Config{MaxDeliveryAttempts: 3})
+	defer srv.Close()
+	sdk := platform.NewSDK(srv.Options()...)
+
+	// The first subscription fails the first attempt to deliver each message
+	var attempts atomic.Int32
+	srv.Subscribe("orders", "ship", sdk.EncoreCloud.CreateSubscriptionHandler("ship", nil, func(ctx context.Context, msgID string, publishTime time.Time, deliveryAttempt int, attrs map[string]string, data []byte) error {
+		attempts.Add(1)
+		if deliveryAttempt == 1 {
+			return errors.New("not yet")
+		}
+		return nil
+	}))
+	// The second always fails
+	srv.Subscribe("orders", "bill", sdk.EncoreCloud.CreateSubscriptionHandler("bill", nil, func(ctx context.Context, msgID string, publishTime time.Time, deliveryAttempt int, attrs map[string]string, data []byte) error {
+		return errors.New("broken")
+	}))
+
+	ctx := context.Background()
+	msgID, err := sdk.EncoreCloud.PublishToTopic(ctx, "orders", "customer-1", map[string]string{"k": "v"}, []byte(`{"order":1}`))
+	c.Assert(err, qt.IsNil)
+	c.Assert(srv.Wait(ctx), qt.IsNil)
+
+	published := srv.Published("orders")
+	c.Assert(published, qt.HasLen, 1)
+	c.Assert(published[0].ID, qt.Equals, msgID)
+	c.Assert(published[0].OrderingKey, qt.Equals, "customer-1")
+	c.Assert(published[0].Attributes, qt.DeepEquals, map[string]string{"k": "v"})
+	c.Assert(string(published[0].Data), qt.Equals, `{"order":1}`)
+
+	c.Assert(srv.Deliveries("ship"), qt.DeepEquals, []Delivery{
+		{Subscription: "ship", MessageID: msgID, Attempt: 1, Error: "nacked: not yet"},
+		{Subscription: "ship", MessageID: msgID, Attempt: 2, Acked: true},
+	})
+	c.Assert(attempts.Load(), qt.Equals, int32(2))
+
+	bill := srv.Deliveries("bill")
+	c.Assert(bill, qt.HasLen, 3)
+	for i, delivery := range bill {
+		c.Assert(delivery.Attempt, qt.Equals, i+1)
+		c.Assert(delivery.Acked, qt.IsFalse)
+		c.Assert(delivery.Error, qt.Equals, "nacked: broken")
+	}
+}
+
+func TestServer_PublishFailures(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	srv := NewServer(Config{})
+	defer srv.Close()
+	ctx := context.Background()
+
+	// Injected failures are retried by the SDK
+	srv.FailPublishes(2, http.StatusServiceUnavailable)
+	retry := platform.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, Multiplier: 1}
+	sdk := platform.NewSDK(append(srv.Options(), platform.WithRetryPolicy(retry))...)
+	_, err := sdk.EncoreCloud.PublishToTopic(ctx, "orders", "", nil, []byte(`{}`))
+	c.Assert(err, qt.IsNil)
+	c.Assert(srv.Published("orders"), qt.HasLen, 1)
+
+	// Requests signed with the wrong key are rejected
+	wrongKey := platform.NewSDK(append(srv.Options(), platform.WithAuthKeys(auth.Key{KeyID: 1, Data: []byte("wrong")}))...)
+	_, err = wrongKey.EncoreCloud.PublishToTopic(ctx, "orders", "", nil, []byte(`{}`))
+	var apiErr *encorecloud.APIError
+	c.Assert(errors.As(err, &apiErr), qt.IsTrue)
+	c.Assert(apiErr.StatusCode, qt.Equals, http.StatusUnauthorized)
+	c.Assert(srv.Published("orders"), qt.HasLen, 1)
+
+	// The connectivity check works against the fake too
+	report, err := sdk.Ping(ctx)
+	c.Assert(err, qt.IsNil)
+	c.Assert(report.KeyAccepted, qt.IsTrue)
+}
+
+func TestServer_DelayedDelivery(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	srv := NewServer(Config{})
+	defer srv.Close()
+	sdk := platform.NewSDK(srv.Options()...)
+
+	delivered := make(map[string]time.Time)
+	var mu sync.Mutex
+	srv.Subscribe("reminders", "send", sdk.EncoreCloud.CreateSubscriptionHandler("send", nil, func(ctx context.Context, msgID string, publishTime time.Time, deliveryAttempt int, attrs map[string]string, data []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		delivered[string(data)] = time.Now()
+		return nil
+	}))
+
+	ctx := context.Background()
+	start := time.Now()
+	_, err := sdk.EncoreCloud.PublishToTopic(ctx, "reminders", "", nil, []byte(`"later"`), encorecloud.DeliverAfter(100*time.Millisecond))
+	c.Assert(err, qt.IsNil)
+	_, err = sdk.EncoreCloud.PublishToTopic(ctx, "reminders", "", nil, []byte(`"now"`))
+	c.Assert(err, qt.IsNil)
+	c.Assert(srv.Wait(ctx), qt.IsNil)
+
+	// The delayed message is held back, without holding back the other one
+	published := srv.Published("reminders")
+	c.Assert(published[0].DeliverAt.Sub(start) >= 100*time.Millisecond, qt.IsTrue)
+	c.Assert(published[1].DeliverAt.IsZero(), qt.IsTrue)
+	c.Assert(delivered[`"later"`].Before(published[0].DeliverAt), qt.IsFalse)
+	c.Assert(delivered[`"now"`].Before(delivered[`"later"`]), qt.IsTrue)
+}
@@ -0,0 +1,38 @@
+package platform
+
+import (
+	"go.encore.dev/platform-sdk/internal/client"
+)
+
+// Recorder is an [http.RoundTripper] which records the SDK's interactions with the Encore
+// Platform to a cassette file and replays them in later runs, allowing code which uses the
+// SDK to be tested quickly and offline against real responses.
+//
+// Use it with [WithTransport]:
+//
+//	recorder, err := platform.NewRecorder("testdata/publish.json", platform.RecorderConfig{})
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	t.Cleanup(func() { _ = recorder.Save() })
+//	sdk := platform.NewSDK(platform.WithTransport(recorder), ...)
+//
+// The Authorization header of recorded requests is redacted.
+type Recorder = client.Recorder
+
+// RecorderConfig configures a [Recorder].
+type RecorderConfig = client.RecorderConfig
+
+// RecorderMode is the mode a [Recorder] operates in.
+type RecorderMode = client.RecorderMode
+
+const (
+	ReplayOrRecord = client.ReplayOrRecord // Replay the cassette if it exists, otherwise record it
+	Replay         = client.Replay         // Replay the cassette, never sending requests
+	Record         = client.Record         // Send every request and record a new cassette
+)
+
+// NewRecorder returns a [Recorder] for the cassette file at path.
+func NewRecorder(path string, cfg RecorderConfig) (*Recorder, error) {
+	return client.NewRecorder(path, cfg) // nolint: wrapcheck
+}
@@ -0,0 +1,165 @@
+package platform
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.encore.dev/platform-sdk/pkg/auth"
+)
+
+// EnvRuntimeConfig is the environment variable the Encore runtime config is passed to
+// applications in, as read by [NewSDKFromRuntimeEnv].
+const EnvRuntimeConfig = "ENCORE_RUNTIME_CONFIG"
+
+// Topic describes a Pub/Sub topic hosted by Encore Cloud.
+type Topic struct {
+	ID            string            // The ID of the topic, as passed to [encorecloud.Client.PublishToTopic]
+	Subscriptions map[string]string // The IDs of the topic's subscriptions, keyed by their name in the application
+}
+
+// runtimeConfig is the subset of the Encore runtime config used by the SDK.
+type runtimeConfig struct {
+	AppSlug         string                   `json:"app_slug"`
+	EnvName         string                   `json:"env_name"`
+	EncoreCloudAPI  *runtimeEncoreCloudAPI   `json:"ec_api"`
+	PubsubProviders []*runtimePubsubProvider `json:"pubsub_providers"`
+	PubsubTopics    map[string]*runtimeTopic `json:"pubsub_topics"`
+}
+
+type runtimeEncoreCloudAPI struct {
+	Server   string     `json:"server"`
+	AuthKeys []auth.Key `json:"auth_keys"`
+}
+
+type runtimePubsubProvider struct {
+	EncoreCloud *struct{} `json:"encore_cloud"`
+}
+
+type runtimeTopic struct {
+	ProviderID    int                             `json:"provider_id"`
+	ProviderName  string                          `json:"provider_name"`
+	Subscriptions map[string]*runtimeSubscription `json:"subscriptions"`
+}
+
+type runtimeSubscription struct {
+	ProviderName string `json:"provider_name"`
+}
+
+// NewSDKFromRuntimeConfig creates a new SDK configured from the JSON encoded Encore runtime config,
+// which is accepted either as JSON or in the base64 encoded form it is passed to applications in.
+//
+// The host, app details and auth keys are taken from the config, and [SDK.Topics] is populated with
+// the topics hosted by Encore Cloud and the IDs of their subscriptions. Any options given are applied
+// after the config, so they take precedence over it. Like [New], it returns an error if the resulting
+// configuration is not valid.
+func NewSDKFromRuntimeConfig(config []byte, options ...Option) (*SDK, error) {
+	rc, err := parseRuntimeConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var rcOptions []Option
+	if rc.AppSlug != "" || rc.EnvName != "" {
+		rcOptions = append(rcOptions, WithAppDetails(rc.AppSlug, rc.EnvName))
+	}
+	if api := rc.EncoreCloudAPI; api != nil {
+		if api.Server != "" {
+			rcOptions = append(rcOptions, WithHost(api.Server))
+		}
+		if len(api.AuthKeys) > 0 {
+			rcOptions = append(rcOptions, WithAuthKeys(api.AuthKeys...))
+		}
+	}
+
+	sdk, err := New(append(rcOptions, options...)...)
+	if err != nil {
+		return nil, err
+	}
+	sdk.Topics = rc.topics()
+	return sdk, nil
+}
+
+// NewSDKFromRuntimeEnv creates a new SDK configured from the Encore runtime config
+// in the [EnvRuntimeConfig] environment variable, see [NewSDKFromRuntimeConfig].
+func NewSDKFromRuntimeEnv(options ...Option) (*SDK, error) {
+	config, ok := os.LookupEnv(EnvRuntimeConfig)
+	if !ok {
+		return nil, fmt.Errorf("%s is not set", EnvRuntimeConfig)
+	}
+	return NewSDKFromRuntimeConfig([]byte(config), options...)
+}
+
+// parseRuntimeConfig parses the runtime config, decoding it first if it is base64 encoded,
+// and decompressing it if it is additionally gzip compressed and prefixed with "gzip:".
+func parseRuntimeConfig(config []byte) (*runtimeConfig, error) {
+	config = bytes.TrimSpace(config)
+	if !bytes.HasPrefix(config, []byte("{")) {
+		encoded, gzipped := strings.CutPrefix(string(config), "gzip:")
+
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			decoded, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+		}
+		if err != nil {
+			return nil, errors.New("invalid runtime config: neither JSON nor base64 encoded")
+		}
+
+		if gzipped {
+			gr, err := gzip.NewReader(bytes.NewReader(decoded))
+			if err != nil {
+				return nil, fmt.Errorf("invalid runtime config: %w", err)
+			}
+			if decoded, err = io.ReadAll(gr); err != nil {
+				return nil, fmt.Errorf("invalid runtime config: %w", err)
+			}
+		}
+		config = decoded
+	}
+
+	rc := &runtimeConfig{}
+	if err := json.Unmarshal(config, rc); err != nil {
+		// Don't wrap the error, as it may contain part of the secret key data
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return nil, fmt.Errorf("invalid runtime config: malformed JSON at offset %d", syntaxErr.Offset)
+		}
+		return nil, errors.New("invalid runtime config: unexpected JSON structure")
+	}
+	return rc, nil
+}
+
+// topics returns the topics in the runtime config which are hosted by Encore Cloud.
+func (rc *runtimeConfig) topics() map[string]Topic {
+	topics := make(map[string]Topic)
+	for name, topic := range rc.PubsubTopics {
+		if topic == nil {
+			continue
+		}
+
+		// If the providers are listed, skip topics which are hosted elsewhere
+		if len(rc.PubsubProviders) > 0 {
+			if topic.ProviderID < 0 || topic.ProviderID >= len(rc.PubsubProviders) {
+				continue
+			}
+			if provider := rc.PubsubProviders[topic.ProviderID]; provider == nil || provider.EncoreCloud == nil {
+				continue
+			}
+		}
+
+		subscriptions := make(map[string]string, len(topic.Subscriptions))
+		for subName, sub := range topic.Subscriptions {
+			if sub != nil {
+				subscriptions[subName] = sub.ProviderName
+			}
+		}
+		topics[name] = Topic{ID: topic.ProviderName, Subscriptions: subscriptions}
+	}
+	return topics
+}
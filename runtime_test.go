@@ -0,0 +1,103 @@
+package platform
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+const testRuntimeConfig = `{
+	"app_slug": "app",
+	"env_name": "env",
+	"ec_api": {
+		"server": "https://platform.example.com",
+		"auth_keys": [{"kid": 1, "data": "c2VjcmV0"}]
+	},
+	"pubsub_providers": [{"encore_cloud": {}}, {"gcp": {}}],
+	"pubsub_topics": {
+		"orders": {
+			"provider_id": 0,
+			"provider_name": "topic-orders",
+			"subscriptions": {
+				"ship": {"provider_name": "sub-ship"},
+				"bill": {"provider_name": "sub-bill"}
+			}
+		},
+		"elsewhere": {"provider_id": 1, "provider_name": "projects/x/topics/elsewhere"}
+	}
+}`
+
+func TestNewSDKFromRuntimeConfig(t *testing.T) {
+	t.Parallel()
+
+	var gzipped bytes.Buffer
+	gw := gzip.NewWriter(&gzipped)
+	_, _ = gw.Write([]byte(testRuntimeConfig))
+	_ = gw.Close()
+
+	wantTopics := map[string]Topic{
+		"orders": {ID: "topic-orders", Subscriptions: map[string]string{"ship": "sub-ship", "bill": "sub-bill"}},
+	}
+
+	tests := []struct {
+		name    string
+		config  string
+		options []Option
+		wantErr string
+	}{
+		{
+			name:   "json",
+			config: testRuntimeConfig,
+		},
+		{
+			name:   "base64",
+			config: base64.StdEncoding.EncodeToString([]byte(testRuntimeConfig)),
+		},
+		{
+			name:   "gzipped base64",
+			config: "gzip:" + base64.StdEncoding.EncodeToString(gzipped.Bytes()),
+		},
+		{
+			name:    "options override config",
+			config:  `{"app_slug": "app", "env_name": "env", "ec_api": {"server": "not a url", "auth_keys": [{"kid": 1, "data": "c2VjcmV0"}]}}`,
+			options: []Option{WithHost("https://other.example.com")},
+		},
+		{
+			name:    "missing encore cloud api",
+			config:  `{"app_slug": "app", "env_name": "env"}`,
+			wantErr: "invalid SDK configuration: no host configured\nno signing key configured",
+		},
+		{
+			name:    "not encoded",
+			config:  "not a config!",
+			wantErr: "invalid runtime config: neither JSON nor base64 encoded",
+		},
+		{
+			name:    "malformed json",
+			config:  `{"app_slug": `,
+			wantErr: "invalid runtime config: malformed JSON at offset .*",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := qt.New(t)
+
+			sdk, err := NewSDKFromRuntimeConfig([]byte(tt.config), tt.options...)
+			if tt.wantErr != "" {
+				c.Assert(err, qt.ErrorMatches, tt.wantErr)
+				return
+			}
+			c.Assert(err, qt.IsNil)
+			c.Assert(sdk.EncoreCloud, qt.IsNotNil)
+			if tt.options == nil {
+				c.Assert(sdk.Topics, qt.DeepEquals, wantTopics)
+			}
+		})
+	}
+}
@@ -1,25 +1,55 @@
 package platform
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/benbjohnson/clock"
 	"go.encore.dev/platform-sdk/encorecloud"
 	"go.encore.dev/platform-sdk/internal/client"
 )
 
 // NewSDK creates a new SDK with the specified options.
+//
+// It does not validate the resulting configuration, use [New] to
+// create an SDK which reports configuration errors up front.
 func NewSDK(options ...Option) *SDK {
-	// Create the raw client
+	return newSDK(newConfig(options))
+}
+
+// New creates a new SDK with the specified options, returning an error if the
+// resulting configuration is incomplete or inconsistent, for instance if the host
+// is not a valid URL, no signing key has been given, or the same key ID has been
+// given with different key data.
+func New(options ...Option) (*SDK, error) {
+	cfg := newConfig(options)
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid SDK configuration: %w", err)
+	}
+	return newSDK(cfg), nil
+}
+
+// newConfig creates the client configuration from the default configuration
+// and the specified options.
+func newConfig(options []Option) *client.Config {
 	cfg := &client.Config{
 		Clock: clock.New(),
+		Retry: client.DefaultRetryPolicy(),
 	}
 	for _, option := range options {
 		option(cfg)
 	}
+	return cfg
+}
+
+func newSDK(cfg *client.Config) *SDK {
+	// Create the raw client
 	rawClient := client.New(cfg)
 
 	// Now create the SDK struct
 	return &SDK{
 		EncoreCloud: encorecloud.NewClient(rawClient),
+		client:      rawClient,
 	}
 }
 
@@ -28,4 +58,24 @@ type SDK struct {
 	// EncoreCloud is the client for services hosted specifically
 	// to support applications deployed within the Encore Cloud.
 	EncoreCloud *encorecloud.Client
+
+	// Topics are the Pub/Sub topics hosted by Encore Cloud, keyed by their name in the application.
+	// It is only populated when the SDK is created from the Encore runtime config.
+	Topics map[string]Topic
+
+	client *client.Client
+}
+
+// Close stops any background work started by the SDK, such as the health checks
+// made when [WithFailover] is used.
+func (s *SDK) Close() {
+	if s.client != nil {
+		s.client.Close()
+	}
+}
+
+// Ping checks the SDK can reach and authenticate with Encore Cloud,
+// see [encorecloud.Client.CheckConnectivity].
+func (s *SDK) Ping(ctx context.Context) (*encorecloud.ConnectivityReport, error) {
+	return s.EncoreCloud.CheckConnectivity(ctx)
 }
@@ -0,0 +1,155 @@
+package platform
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"go.encore.dev/platform-sdk/pkg/auth"
+)
+
+func TestNew_Validation(t *testing.T) {
+	t.Parallel()
+
+	validKey := auth.Key{KeyID: 1, Data: []byte("secret")}
+
+	tests := []struct {
+		name    string
+		options []Option
+		wantErr string
+	}{
+		{
+			name:    "valid",
+			options: []Option{WithHost("https://platform.example.com"), WithAppDetails("app", "env"), WithAuthKeys(validKey)},
+		},
+		{
+			name:    "missing everything",
+			wantErr: "invalid SDK configuration: no host configured\nno app slug configured\nno environment name configured\nno signing key configured",
+		},
+		{
+			name:    "relative host",
+			options: []Option{WithHost("platform.example.com"), WithAppDetails("app", "env"), WithAuthKeys(validKey)},
+			wantErr: `invalid SDK configuration: invalid host "platform.example.com": must be an absolute http or https URL`,
+		},
+		{
+			name:    "unsupported scheme",
+			options: []Option{WithHost("ftp://platform.example.com"), WithAppDetails("app", "env"), WithAuthKeys(validKey)},
+			wantErr: `invalid SDK configuration: invalid host "ftp://platform.example.com": must be an absolute http or https URL`,
+		},
+		{
+			name:    "empty key data",
+			options: []Option{WithHost("https://platform.example.com"), WithAppDetails("app", "env"), WithAuthKeys(auth.Key{KeyID: 1})},
+			wantErr: "invalid SDK configuration: no signing key configured\nauth key 1 has no data",
+		},
+		{
+			name: "conflicting key IDs",
+			options: []Option{
+				WithHost("https://platform.example.com"), WithAppDetails("app", "env"),
+				WithAuthKeys(validKey, auth.Key{KeyID: 1, Data: []byte("other")}),
+			},
+			wantErr: "invalid SDK configuration: auth key 1 configured multiple times with different data",
+		},
+		{
+			name: "failover endpoints",
+			options: []Option{
+				WithFailover(FailoverConfig{Endpoints: []string{"https://eu.example.com", "https://us.example.com"}}),
+				WithAppDetails("app", "env"), WithAuthKeys(validKey),
+			},
+		},
+		{
+			name: "invalid failover endpoint",
+			options: []Option{
+				WithFailover(FailoverConfig{Endpoints: []string{"https://eu.example.com", "us.example.com"}}),
+				WithAppDetails("app", "env"), WithAuthKeys(validKey),
+			},
+			wantErr: `invalid SDK configuration: invalid failover endpoint "us.example.com": must be an absolute http or https URL`,
+		},
+		{
+			name: "identical duplicate keys",
+			options: []Option{
+				WithHost("https://platform.example.com"), WithAppDetails("app", "env"),
+				WithAuthKeys(validKey, validKey),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := qt.New(t)
+
+			sdk, err := New(tt.options...)
+			if tt.wantErr != "" {
+				c.Assert(err, qt.ErrorMatches, tt.wantErr)
+				c.Assert(sdk, qt.IsNil)
+				return
+			}
+			c.Assert(err, qt.IsNil)
+			c.Assert(sdk.EncoreCloud, qt.IsNotNil)
+		})
+	}
+}
+
+func TestNewSDKFromEnv(t *testing.T) {
+	t.Parallel()
+
+	validEnv := map[string]string{
+		EnvHost:     "https://platform.example.com",
+		EnvAppSlug:  "app",
+		EnvEnvName:  "env",
+		EnvAuthKeys: `[{"kid": 1, "data": "c2VjcmV0"}]`,
+	}
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		options []Option
+		wantErr string
+	}{
+		{
+			name: "valid",
+			env:  validEnv,
+		},
+		{
+			name:    "options override environment",
+			env:     map[string]string{EnvHost: "not a url", EnvAppSlug: "app", EnvEnvName: "env", EnvAuthKeys: validEnv[EnvAuthKeys]},
+			options: []Option{WithHost("https://other.example.com")},
+		},
+		{
+			name:    "empty environment",
+			env:     map[string]string{},
+			wantErr: "invalid SDK configuration: no host configured\nno app slug configured\nno environment name configured\nno signing key configured",
+		},
+		{
+			name:    "malformed auth keys",
+			env:     map[string]string{EnvHost: validEnv[EnvHost], EnvAppSlug: "app", EnvEnvName: "env", EnvAuthKeys: `[{"kid": 1, "data": "secret`},
+			wantErr: "invalid ENCORE_PLATFORM_AUTH_KEYS: malformed JSON at offset .*",
+		},
+		{
+			name:    "wrongly typed auth keys",
+			env:     map[string]string{EnvHost: validEnv[EnvHost], EnvAppSlug: "app", EnvEnvName: "env", EnvAuthKeys: `{"kid": 1}`},
+			wantErr: `invalid ENCORE_PLATFORM_AUTH_KEYS: expected a JSON array of .*`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := qt.New(t)
+
+			lookup := func(key string) (string, bool) {
+				value, ok := tt.env[key]
+				return value, ok
+			}
+			sdk, err := newSDKFromLookup(lookup, tt.options...)
+			if tt.wantErr != "" {
+				c.Assert(err, qt.ErrorMatches, tt.wantErr)
+				return
+			}
+			c.Assert(err, qt.IsNil)
+			c.Assert(sdk.EncoreCloud, qt.IsNotNil)
+		})
+	}
+}